@@ -55,15 +55,31 @@ type ContainerConfig interface {
 	FindSubPartition(dev *types.Device) []*types.Device
 	UpdateDevice(device *types.Device, isAddDevice bool) error
 	UpdateDeviceNode(device string, major, minor int64)
+	UpdateDevicePermissions(device *types.Device) error
+	UpdateDeviceRule(rule *types.Device, isAdd bool) error
+	GetDeviceRules() []string
 
 	IsBindInConfig(bind *types.Bind) bool
 	UpdateBind(bind *types.Bind, isAddBind bool) (bool, error)
+	UpdateBindOption(bind *types.Bind) (string, error)
 	GetBinds() []string
 	GetBindInConfig(bind *types.Bind) (*HostMapping, error)
+	UpdateMount(m *MountMapping, isAdd bool) error
+	FindMount(destination string) *MountMapping
+	GetMounts() []*MountMapping
+	UpdateVolume(v *VolumeMapping, isAdd bool) error
+	FindVolume(image string) *VolumeMapping
+	GetVolumes() []*VolumeMapping
+	UpdatePathQuota(q *PathQuota, isAdd bool) error
+	FindPathQuota(hostPath string) *PathQuota
+	GetPathQuotas() []*PathQuota
+	UpdateCDIMounts(m *CDIMounts, isAdd bool) error
+	FindCDIMounts(device string) *CDIMounts
 	GetAllDevices() []*DeviceMapping
 	DeviceIndexInArray(device *types.Device) int
 	UpdateDeviceQos(qos *types.Qos, qType QosType) error
-	RemoveDeviceQos(device *types.Device, qType QosType) (bool, error)
+	RemoveDeviceQos(device *types.Device, qType QosType) ([]*types.Qos, error)
+	GetDeviceQos(qType QosType) []*types.Qos
 
 	FindInterfaceByName(config *types.InterfaceConf) *types.InterfaceConf
 	IsConflictInterface(nic *types.InterfaceConf) error
@@ -92,6 +108,41 @@ func NewContainerConfig(c *container.Container) (ContainerConfig, error) {
 	return hConfig, nil
 }
 
+// LoadAllContainerHookConfigs loads the hook configs of all containers in storage path, keyed by container id.
+// Containers without hook config are skipped, it fails if any of the configs is broken.
+func LoadAllContainerHookConfigs(storagePath string) (map[string]*ContainerHookConfig, error) {
+	configs, broken, err := LoadReadableContainerHookConfigs(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range broken {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// LoadReadableContainerHookConfigs is like LoadAllContainerHookConfigs, but the errors of broken configs
+// are returned separately keyed by container id, for the callers which could go on without them.
+func LoadReadableContainerHookConfigs(storagePath string) (map[string]*ContainerHookConfig, map[string]error, error) {
+	files, err := filepath.Glob(filepath.Join(storagePath, "*", defaultConfigFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	configs := make(map[string]*ContainerHookConfig)
+	broken := make(map[string]error)
+	for _, file := range files {
+		id := filepath.Base(filepath.Dir(file))
+		hConfig, err := LoadContainerHookConfig(file)
+		if err != nil {
+			broken[id] = fmt.Errorf("failed to load %s: %v", file, err)
+			continue
+		}
+		hConfig.configPath = file
+		configs[id] = hConfig
+	}
+	return configs, broken, nil
+}
+
 // DeviceMapping represents the device mapping between the host and the container.
 type DeviceMapping struct {
 	Type              string
@@ -101,6 +152,12 @@ type DeviceMapping struct {
 	PathInContainer   string
 	CgroupPermissions string
 	Parent            string
+	DmUUID            string          `json:"DmUUID,omitempty"`
+	NodeAttr          *types.NodeAttr `json:"NodeAttr,omitempty"`
+	DiskLinks         bool            `json:"DiskLinks,omitempty"`
+	BindNode          bool            `json:"BindNode,omitempty"`
+	Sharing           string          `json:"Sharing,omitempty"`
+	CDIDevice         string          `json:"CDIDevice,omitempty"`
 }
 
 type info struct {
@@ -186,6 +243,11 @@ type ContainerHookConfig struct {
 	BlkioWeight       []*types.Qos           `json:"blkioWeight,omitempty"`
 	NetworkInterfaces []*types.InterfaceConf `json:"networkInterfaces,omitempty"`
 	NetworkRoutes     []*types.Route         `json:"networkRoute,omitempty"`
+	DeviceRules       []string               `json:"deviceRules,omitempty"`
+	Mounts            []*MountMapping        `json:"mounts,omitempty"`
+	Volumes           []*VolumeMapping       `json:"volumes,omitempty"`
+	PathQuotas        []*PathQuota           `json:"pathQuotas,omitempty"`
+	CDIMounts         []*CDIMounts           `json:"cdiMounts,omitempty"`
 	configPath        string
 	dirty             bool
 	bi                *bindsInfo
@@ -0,0 +1,56 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: mounts of CDI devices
+// Author: zhangwei
+// Create: 2018-01-18
+
+package config
+
+import (
+	"fmt"
+)
+
+// CDIMounts are the binds added for the mounts of a CDI device, they are removed along with the device.
+type CDIMounts struct {
+	Device string   // fully qualified name of CDI device
+	Binds  []string // binds in the format of bindToAdd
+}
+
+// FindCDIMounts returns the mounts of CDI device, nil if not found.
+func (config *ContainerHookConfig) FindCDIMounts(device string) *CDIMounts {
+	for _, m := range config.CDIMounts {
+		if m.Device == device {
+			return m
+		}
+	}
+	return nil
+}
+
+// UpdateCDIMounts will add, replace or remove the mounts of CDI device in config
+func (config *ContainerHookConfig) UpdateCDIMounts(m *CDIMounts, isAdd bool) error {
+	for index, eMounts := range config.CDIMounts {
+		if eMounts.Device != m.Device {
+			continue
+		}
+		config.dirty = true
+		if isAdd {
+			config.CDIMounts[index] = m
+		} else {
+			config.CDIMounts = append(config.CDIMounts[:index], config.CDIMounts[index+1:]...)
+		}
+		return nil
+	}
+	if !isAdd {
+		return fmt.Errorf("no mounts of CDI device %s", m.Device)
+	}
+	config.dirty = true
+	config.CDIMounts = append(config.CDIMounts, m)
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"isula.org/syscontainer-tools/types"
@@ -120,6 +121,12 @@ func (config *ContainerHookConfig) FindDeviceByMapping(device *types.Device) *ty
 				Minor:       eDevice.Minor,
 				Type:        eDevice.Type,
 				Parent:      eDevice.Parent,
+				DmUUID:      eDevice.DmUUID,
+				NodeAttr:    eDevice.NodeAttr,
+				DiskLinks:   eDevice.DiskLinks,
+				BindNode:    eDevice.BindNode,
+				Sharing:     eDevice.Sharing,
+				CDIDevice:   eDevice.CDIDevice,
 			}
 		}
 	}
@@ -139,6 +146,12 @@ func (config *ContainerHookConfig) FindSubPartition(device *types.Device) []*typ
 				Minor:       eDevice.Minor,
 				Type:        eDevice.Type,
 				Parent:      eDevice.Parent,
+				DmUUID:      eDevice.DmUUID,
+				NodeAttr:    eDevice.NodeAttr,
+				DiskLinks:   eDevice.DiskLinks,
+				BindNode:    eDevice.BindNode,
+				Sharing:     eDevice.Sharing,
+				CDIDevice:   eDevice.CDIDevice,
 			})
 		}
 	}
@@ -155,6 +168,12 @@ func (config *ContainerHookConfig) UpdateDevice(device *types.Device, isAddDevic
 		PathInContainer:   device.Path,
 		CgroupPermissions: device.Permissions,
 		Parent:            device.Parent,
+		DmUUID:            device.DmUUID,
+		NodeAttr:          device.NodeAttr,
+		DiskLinks:         device.DiskLinks,
+		BindNode:          device.BindNode,
+		Sharing:           device.Sharing,
+		CDIDevice:         device.CDIDevice,
 	}
 
 	// add device action:
@@ -227,6 +246,37 @@ func (config *ContainerHookConfig) UpdateBind(bind *types.Bind, isAddBind bool)
 	return config.removeBind(bind)
 }
 
+// UpdateBindOption changes the mount option of the bind in config, returns the old one.
+// Host path mounted to other paths in container should have the same option, it's refused.
+func (config *ContainerHookConfig) UpdateBindOption(bind *types.Bind) (string, error) {
+	index := config.bindIndexInArray(bind, config.Binds)
+	if index == -1 {
+		return "", fmt.Errorf("Path pair(%s:%s) is not added by syscontainer-tools", bind.HostPath, bind.ContainerPath)
+	}
+	mp, err := parseMapping(config.Binds[index])
+	if err != nil {
+		return "", err
+	}
+	for i, bindstr := range config.Binds {
+		other, err := parseMapping(bindstr)
+		if err != nil || i == index {
+			continue
+		}
+		if other.PathOnHost == bind.HostPath {
+			return "", fmt.Errorf("host path %s is also mounted to %s in container, can not change its option alone", bind.HostPath, other.PathInContainer)
+		}
+	}
+
+	config.bi.l.Lock()
+	if hostInfo, ok := config.bi.pathInHost[bind.HostPath]; ok {
+		hostInfo.perm = bind.MountOption
+	}
+	config.bi.l.Unlock()
+	config.dirty = true
+	config.Binds[index] = bind.ToString()
+	return mp.Permission, nil
+}
+
 // GetBinds get binds of hook config
 func (config *ContainerHookConfig) GetBinds() []string {
 	return config.Binds[:]
@@ -237,11 +287,60 @@ func (config *ContainerHookConfig) GetAllDevices() []*DeviceMapping {
 	return config.Devices[:]
 }
 
+// UpdateDevicePermissions will update the cgroup permissions of an added device
+func (config *ContainerHookConfig) UpdateDevicePermissions(device *types.Device) error {
+	index := config.DeviceIndexInArray(device)
+	if index == -1 {
+		return fmt.Errorf("device %s:%s has not been added into container", device.PathOnHost, device.Path)
+	}
+	if config.Devices[index].CgroupPermissions != device.Permissions {
+		config.dirty = true
+		config.Devices[index].CgroupPermissions = device.Permissions
+	}
+	return nil
+}
+
+func (config *ContainerHookConfig) deviceRuleIndex(rule *types.Device) int {
+	// rule is identified by type and device number, permissions are not compared.
+	prefix := strings.TrimSuffix(rule.CgroupString(), rule.Permissions)
+	for index, r := range config.DeviceRules {
+		if strings.HasPrefix(r, prefix) {
+			return index
+		}
+	}
+	return -1
+}
+
+// UpdateDeviceRule will add or remove the cgroup-only device rule
+func (config *ContainerHookConfig) UpdateDeviceRule(rule *types.Device, isAdd bool) error {
+	index := config.deviceRuleIndex(rule)
+	if isAdd {
+		if index != -1 {
+			return fmt.Errorf("device rule %q has been already added into container", config.DeviceRules[index])
+		}
+		config.dirty = true
+		config.DeviceRules = append(config.DeviceRules, rule.CgroupString())
+		return nil
+	}
+	if index == -1 {
+		return fmt.Errorf("device rule %q has not been added into container", rule.CgroupString())
+	}
+	config.dirty = true
+	config.DeviceRules = append(config.DeviceRules[:index], config.DeviceRules[index+1:]...)
+	return nil
+}
+
+// GetDeviceRules get cgroup-only device rules of hook config
+func (config *ContainerHookConfig) GetDeviceRules() []string {
+	return config.DeviceRules[:]
+}
+
 // UpdateDeviceQos will update the qos for device
 func (config *ContainerHookConfig) UpdateDeviceQos(qos *types.Qos, qType QosType) error {
 	update := func(qosArr []*types.Qos, qos *types.Qos) []*types.Qos {
 		for _, q := range qosArr {
-			if q.Major == qos.Major && q.Minor == qos.Minor {
+			// qos of several stacked devices could be applied to the same physical device.
+			if q.Major == qos.Major && q.Minor == qos.Minor && q.Holder == qos.Holder {
 				if q.Value != qos.Value {
 					config.dirty = true
 					q.Value = qos.Value
@@ -268,19 +367,43 @@ func (config *ContainerHookConfig) UpdateDeviceQos(qos *types.Qos, qType QosType
 	return nil
 }
 
-// RemoveDeviceQos remove qos for device
-func (config *ContainerHookConfig) RemoveDeviceQos(device *types.Device, qType QosType) (bool, error) {
-	remove := func(qosArr []*types.Qos, device *types.Device) ([]*types.Qos, bool) {
-		for index, q := range qosArr {
-			if q.Major == device.Major && q.Minor == device.Minor {
+// StrictestQos returns the qos with the smallest non-zero value of the device number in qosArr,
+// which is written to cgroup when several entries are applied to the same device, nil if none.
+func StrictestQos(qosArr []*types.Qos, major, minor int64) *types.Qos {
+	var strictest *types.Qos
+	var min uint64
+	for _, q := range qosArr {
+		if q.Major != major || q.Minor != minor {
+			continue
+		}
+		value, err := strconv.ParseUint(q.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if strictest == nil || (value != 0 && (min == 0 || value < min)) {
+			strictest, min = q, value
+		}
+	}
+	return strictest
+}
+
+// RemoveDeviceQos remove qos for device, including the ones applied to
+// its underlying physical devices. It returns the removed qos.
+func (config *ContainerHookConfig) RemoveDeviceQos(device *types.Device, qType QosType) ([]*types.Qos, error) {
+	remove := func(qosArr []*types.Qos, device *types.Device) ([]*types.Qos, []*types.Qos) {
+		var left, removed []*types.Qos
+		for _, q := range qosArr {
+			if (q.Holder == "" && q.Major == device.Major && q.Minor == device.Minor) ||
+				(q.Holder != "" && q.Holder == device.PathOnHost) {
 				config.dirty = true
-				qosArr = append(qosArr[:index], qosArr[index+1:]...)
-				return qosArr, true
+				removed = append(removed, q)
+				continue
 			}
+			left = append(left, q)
 		}
-		return qosArr, false
+		return left, removed
 	}
-	var ret bool
+	var ret []*types.Qos
 	switch qType {
 	case QosReadIOPS:
 		config.ReadIOPS, ret = remove(config.ReadIOPS, device)
@@ -296,6 +419,23 @@ func (config *ContainerHookConfig) RemoveDeviceQos(device *types.Device, qType Q
 	return ret, nil
 }
 
+// GetDeviceQos returns the qos of the type
+func (config *ContainerHookConfig) GetDeviceQos(qType QosType) []*types.Qos {
+	switch qType {
+	case QosReadIOPS:
+		return config.ReadIOPS[:]
+	case QosWriteIOPS:
+		return config.WriteIOPS[:]
+	case QosReadBps:
+		return config.ReadBps[:]
+	case QosWriteBps:
+		return config.WriteBps[:]
+	case QosBlkioWeight:
+		return config.BlkioWeight[:]
+	}
+	return nil
+}
+
 // CheckPathNum check path num reach max limit or not
 func (config *ContainerHookConfig) CheckPathNum() error {
 	if len(config.Binds) > MaxPathNum {
@@ -0,0 +1,93 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: device qos config tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package config
+
+import (
+	"testing"
+
+	"isula.org/syscontainer-tools/types"
+)
+
+func TestUpdateDeviceQosHolder(t *testing.T) {
+	config := &ContainerHookConfig{}
+	// qos of two dm devices stacked on 8:0 are kept separately.
+	qosArr := []*types.Qos{
+		{Major: 8, Minor: 0, Value: "1000", Holder: "/dev/dm-0"},
+		{Major: 8, Minor: 0, Value: "2000", Holder: "/dev/dm-1"},
+		{Major: 8, Minor: 0, Value: "3000"},
+	}
+	for _, qos := range qosArr {
+		if err := config.UpdateDeviceQos(qos, QosReadBps); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(config.ReadBps) != 3 {
+		t.Fatalf("got %d qos entries, want 3: %v", len(config.ReadBps), config.ReadBps)
+	}
+
+	// the entry of the same holder is updated in place.
+	config.dirty = false
+	if err := config.UpdateDeviceQos(&types.Qos{Major: 8, Minor: 0, Value: "500", Holder: "/dev/dm-1"}, QosReadBps); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.ReadBps) != 3 || config.ReadBps[1].Value != "500" || config.ReadBps[0].Value != "1000" {
+		t.Errorf("qos entries = %v after updating dm-1", config.ReadBps)
+	}
+	if !config.dirty {
+		t.Errorf("config should be dirty after updating qos")
+	}
+
+	// the same value changes nothing.
+	config.dirty = false
+	if err := config.UpdateDeviceQos(&types.Qos{Major: 8, Minor: 0, Value: "3000"}, QosReadBps); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.ReadBps) != 3 || config.dirty {
+		t.Errorf("qos entries = %v, dirty %v after updating the same value", config.ReadBps, config.dirty)
+	}
+	if len(config.WriteBps) != 0 {
+		t.Errorf("write bps should not be changed: %v", config.WriteBps)
+	}
+
+	removed, err := config.RemoveDeviceQos(&types.Device{PathOnHost: "/dev/dm-0", Major: 253, Minor: 0}, QosReadBps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Holder != "/dev/dm-0" || len(config.ReadBps) != 2 {
+		t.Errorf("removed %v, left %v after removing dm-0", removed, config.ReadBps)
+	}
+}
+
+func TestStrictestQos(t *testing.T) {
+	qosArr := []*types.Qos{
+		{Major: 8, Minor: 0, Value: "0", Holder: "/dev/dm-0"},
+		{Major: 8, Minor: 0, Value: "2000", Holder: "/dev/dm-1"},
+		{Major: 8, Minor: 0, Value: "1000"},
+		{Major: 8, Minor: 16, Value: "0"},
+		{Major: 8, Minor: 32, Value: "bad"},
+	}
+	if q := StrictestQos(qosArr, 8, 0); q == nil || q.Value != "1000" {
+		t.Errorf("StrictestQos of 8:0 = %+v, want 1000", q)
+	}
+	// zero means unlimited, it's used only if no other entry.
+	if q := StrictestQos(qosArr, 8, 16); q == nil || q.Value != "0" {
+		t.Errorf("StrictestQos of 8:16 = %+v, want 0", q)
+	}
+	if q := StrictestQos(qosArr, 8, 32); q != nil {
+		t.Errorf("StrictestQos of 8:32 = %+v, want nil", q)
+	}
+	if q := StrictestQos(qosArr, 8, 48); q != nil {
+		t.Errorf("StrictestQos of 8:48 = %+v, want nil", q)
+	}
+}
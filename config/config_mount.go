@@ -0,0 +1,83 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: mount config operation
+// Author: zhangwei
+// Create: 2018-01-18
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MountMapping represents a filesystem mounted to the container by add-mount.
+type MountMapping struct {
+	Source      string
+	Destination string
+	Type        string
+	Options     string `json:"Options,omitempty"`
+	// Transfer is set when the filesystem is mounted on host and propagated through the transfer path,
+	// the ones on block devices, others are mounted in container directly.
+	Transfer bool `json:"Transfer,omitempty"`
+}
+
+// String returns the user input format of mount
+func (m *MountMapping) String() string {
+	return fmt.Sprintf("%s:%s:%s:%s", m.Type, m.Source, m.Destination, m.Options)
+}
+
+// FindMount returns the mount at destination in container, nil if not found.
+func (config *ContainerHookConfig) FindMount(destination string) *MountMapping {
+	for _, m := range config.Mounts {
+		if m.Destination == filepath.Clean(destination) {
+			return m
+		}
+	}
+	return nil
+}
+
+// UpdateMount will add or remove the mount in config
+func (config *ContainerHookConfig) UpdateMount(m *MountMapping, isAdd bool) error {
+	for index, eMount := range config.Mounts {
+		if eMount.Destination != m.Destination {
+			continue
+		}
+		if isAdd {
+			return fmt.Errorf("%s is already mounted in container by %s", m.Destination, eMount)
+		}
+		config.dirty = true
+		config.Mounts = append(config.Mounts[:index], config.Mounts[index+1:]...)
+		return nil
+	}
+	if !isAdd {
+		return fmt.Errorf("%s is not mounted in container by syscontainer-tools", m.Destination)
+	}
+	// paths added by add-path are mounted at the same place.
+	for _, bind := range config.Binds {
+		if arr := strings.SplitN(bind, ":", 3); len(arr) > 1 && arr[1] == m.Destination {
+			return fmt.Errorf("%s is already added to container by add-path", m.Destination)
+		}
+	}
+	for _, v := range config.Volumes {
+		if v.Path == m.Destination {
+			return fmt.Errorf("%s is already mounted in container by volume %s", m.Destination, v)
+		}
+	}
+	config.dirty = true
+	config.Mounts = append(config.Mounts, m)
+	return nil
+}
+
+// GetMounts returns the mounts of hook config
+func (config *ContainerHookConfig) GetMounts() []*MountMapping {
+	return config.Mounts[:]
+}
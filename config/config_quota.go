@@ -0,0 +1,63 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: project quota config
+// Author: zhangwei
+// Create: 2018-01-18
+
+package config
+
+import (
+	"fmt"
+)
+
+// PathQuota is the project quota set on the host path added to container
+type PathQuota struct {
+	HostPath  string
+	ProjectID uint32
+	// Size is the space limit in bytes.
+	Size int64
+}
+
+// FindPathQuota returns the quota of host path, nil if not found.
+func (config *ContainerHookConfig) FindPathQuota(hostPath string) *PathQuota {
+	for _, q := range config.PathQuotas {
+		if q.HostPath == hostPath {
+			return q
+		}
+	}
+	return nil
+}
+
+// UpdatePathQuota will add, replace or remove the quota of host path in config
+func (config *ContainerHookConfig) UpdatePathQuota(q *PathQuota, isAdd bool) error {
+	for index, eQuota := range config.PathQuotas {
+		if eQuota.HostPath != q.HostPath {
+			continue
+		}
+		config.dirty = true
+		if isAdd {
+			config.PathQuotas[index] = q
+		} else {
+			config.PathQuotas = append(config.PathQuotas[:index], config.PathQuotas[index+1:]...)
+		}
+		return nil
+	}
+	if !isAdd {
+		return fmt.Errorf("no quota is set on %s", q.HostPath)
+	}
+	config.dirty = true
+	config.PathQuotas = append(config.PathQuotas, q)
+	return nil
+}
+
+// GetPathQuotas returns the path quotas of hook config
+func (config *ContainerHookConfig) GetPathQuotas() []*PathQuota {
+	return config.PathQuotas[:]
+}
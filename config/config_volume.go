@@ -0,0 +1,85 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: loop-backed volume config operation
+// Author: zhangwei
+// Create: 2018-01-18
+
+package config
+
+import (
+	"fmt"
+)
+
+// VolumeMapping represents an image file attached to the container by a loop device,
+// either the filesystem is mounted at Path, or the block device is exposed as Device.
+type VolumeMapping struct {
+	Image   string
+	FsType  string `json:"FsType,omitempty"`
+	Path    string `json:"Path,omitempty"`
+	Device  string `json:"Device,omitempty"`
+	Options string `json:"Options,omitempty"`
+	// LoopDevice is the loop device which the image is attached to on host,
+	// it's re-attached after container restarts.
+	LoopDevice string `json:"LoopDevice,omitempty"`
+}
+
+// String returns the description of volume
+func (v *VolumeMapping) String() string {
+	if v.Device != "" {
+		return fmt.Sprintf("%s:%s", v.Image, v.Device)
+	}
+	return fmt.Sprintf("%s:%s", v.Image, v.Path)
+}
+
+// FindVolume returns the volume of the image, nil if not found.
+func (config *ContainerHookConfig) FindVolume(image string) *VolumeMapping {
+	for _, v := range config.Volumes {
+		if v.Image == image {
+			return v
+		}
+	}
+	return nil
+}
+
+// UpdateVolume will add or remove the volume in config
+func (config *ContainerHookConfig) UpdateVolume(v *VolumeMapping, isAdd bool) error {
+	for index, eVolume := range config.Volumes {
+		if eVolume.Image != v.Image {
+			continue
+		}
+		if isAdd {
+			return fmt.Errorf("image %s is already attached to container", v.Image)
+		}
+		config.dirty = true
+		config.Volumes = append(config.Volumes[:index], config.Volumes[index+1:]...)
+		return nil
+	}
+	if !isAdd {
+		return fmt.Errorf("image %s is not attached to container", v.Image)
+	}
+	if v.Path != "" {
+		if m := config.FindMount(v.Path); m != nil {
+			return fmt.Errorf("%s is already mounted in container by %s", v.Path, m)
+		}
+		for _, eVolume := range config.Volumes {
+			if eVolume.Path == v.Path {
+				return fmt.Errorf("%s is already mounted in container by volume %s", v.Path, eVolume)
+			}
+		}
+	}
+	config.dirty = true
+	config.Volumes = append(config.Volumes, v)
+	return nil
+}
+
+// GetVolumes returns the volumes of hook config
+func (config *ContainerHookConfig) GetVolumes() []*VolumeMapping {
+	return config.Volumes[:]
+}
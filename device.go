@@ -19,6 +19,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	hconfig "isula.org/syscontainer-tools/config"
 	"isula.org/syscontainer-tools/container"
@@ -32,10 +34,20 @@ import (
 var addDevCommand = cli.Command{
 	Name:      "add-device",
 	Usage:     "add one or more host devices to container",
-	ArgsUsage: `<container_id> hostdevice[:containerdevice][:permission] [hostdevice[:containerdevice][:permission] ...]`,
+	ArgsUsage: `<container_id> hostdevice[:containerdevice][:permission][:options] [hostdevice[:containerdevice][:permission][:options] ...]`,
 	Description: `You can add mutiple host devices to container.
-The program will error out when the host device is not a device or the container device already exists.`,
+The program will error out when the host device is not a device or the container device already exists.
+Options set the owner and mode of the node in container, eg: uid=0,gid=20,mode=0660,
+uid and gid are the ids in container.
+With --cdi, the device nodes and mounts of the device described by CDI specs in /etc/cdi and /var/run/cdi
+are added, their mounts are removed along with the last node of the device by remove-device.
+Both json and yaml specs are supported. Env and hooks in specs are not supported, they are ignored
+with a warning, as they can't be applied to a running container.`,
 	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "cdi",
+			Usage: "Add the device described by CDI specs, by fully qualified name, eg: vendor.com/class=name",
+		},
 		cli.StringSliceFlag{
 			Name:  "blkio-weight-device",
 			Usage: "Set Block IO weight (relative device weight, between 10 and 1000)",
@@ -60,17 +72,54 @@ The program will error out when the host device is not a device or the container
 			Name:  "follow-partition",
 			Usage: "If disk is a base device, add all the sub partitions to container",
 		},
+		cli.BoolFlag{
+			Name:  "disk-links",
+			Usage: "Create /dev/disk/by-id, by-uuid, by-label and by-path links of the disks in container",
+		},
+		cli.BoolFlag{
+			Name:  "bind-node",
+			Usage: "Bind mount the host device node instead of mknod in container, owner and mode options do not work with it",
+		},
+		cli.BoolFlag{
+			Name:  "follow-slaves",
+			Usage: "If disk is a device-mapper device, add the underlying devices(eg: PVs, multipath paths) to container",
+		},
+		cli.BoolFlag{
+			Name:  "follow-holders",
+			Usage: "Add the device-mapper devices stacked on the disk to container",
+		},
+		cli.BoolFlag{
+			Name:  "qos-on-slaves",
+			Usage: "Apply the blkio QOS of device-mapper device to the underlying physical disks",
+		},
 		cli.BoolFlag{
 			Name:  "force",
 			Usage: "If device exists in container, will cover the old file.",
 		},
+		cli.DurationFlag{
+			Name:  "wait",
+			Usage: "Wait for the host devices to appear and settle for at most the duration, eg: 30s",
+		},
+		cli.BoolFlag{
+			Name:  "exclusive",
+			Usage: "Attach the devices to this container only, default for block devices",
+		},
+		cli.BoolFlag{
+			Name:  "shared",
+			Usage: "Allow the devices to be attached to other containers in shared mode, default for char devices",
+		},
+		cli.BoolFlag{
+			Name:  "force-unsafe",
+			Usage: "Add the block device even if it's mounted, used as swap or stacked by dm/md on host",
+		},
 		cli.BoolFlag{
 			Name:  "update-config-only",
 			Usage: "If this flag is set, will not add device to container but update config only",
 		},
 	},
 	Action: func(context *cli.Context) {
-		if context.NArg() < 2 {
+		cdiNames := context.StringSlice("cdi")
+		if context.NArg() < 2 && (context.NArg() < 1 || len(cdiNames) == 0) {
 			fatalf("%s: %q requires a minimum of 2 args", os.Args[0], context.Command.Name)
 		}
 
@@ -96,6 +145,12 @@ The program will error out when the host device is not a device or the container
 			fatal(err)
 		}
 
+		if timeout := context.Duration("wait"); timeout > 0 {
+			if err := waitDevices(context, timeout); err != nil {
+				fatal(err)
+			}
+		}
+
 		devices, err := getDevices(context)
 		if err != nil {
 			fatal(err)
@@ -110,21 +165,61 @@ The program will error out when the host device is not a device or the container
 		if err := setDevicesPath(c, devices); err != nil {
 			fatal(err)
 		}
+		var cdiDevices []*types.Device
+		cdiBinds := make(map[string][]*types.Bind)
+		for _, cdiName := range cdiNames {
+			nodes, binds, err := libdevice.CDIDevices(cdiName, c.GetSpec())
+			if err != nil {
+				fatal(err)
+			}
+			cdiDevices = append(cdiDevices, nodes...)
+			cdiBinds[cdiName] = binds
+		}
+		devices = append(devices, cdiDevices...)
+		if context.Bool("exclusive") && context.Bool("shared") {
+			fatalf("--exclusive and --shared can not be used together")
+		}
+		for _, device := range devices {
+			device.DiskLinks = context.Bool("disk-links")
+			device.BindNode = context.Bool("bind-node")
+			if context.Bool("exclusive") {
+				device.Sharing = libdevice.SharingExclusive
+			} else if context.Bool("shared") {
+				device.Sharing = libdevice.SharingShared
+			}
+		}
 
 		opts := &types.AddDeviceOptions{
 			Force:            context.Bool("force"),
 			UpdateConfigOnly: context.Bool("update-config-only"),
+			QosOnSlaves:      context.Bool("qos-on-slaves"),
+			ForceUnsafe:      context.Bool("force-unsafe"),
 			ReadBps:          readBps,
 			WriteBps:         writeBps,
 			ReadIOPS:         readIOPS,
 			WriteIOPS:        writeIOPS,
 			BlkioWeight:      blkioWeight,
 		}
+		if err := expandQosOptions(opts); err != nil {
+			fatal(err)
+		}
 
 		// handle add device here
 		if err = libdevice.AddDevice(c, devices, opts); err != nil {
 			fatalf("Failed to add device: %v", err)
 		}
+		for _, cdiName := range cdiNames {
+			if len(cdiBinds[cdiName]) == 0 {
+				continue
+			}
+			if err := libdevice.AddCDIPaths(c, cdiName, cdiBinds[cdiName]); err != nil {
+				// the devices are useless without the mounts, roll them back along with the mounts added.
+				if rErr := libdevice.RemoveDevice(c, cdiDevices, &types.RemoveDeviceOptions{Force: true}); rErr != nil {
+					logrus.Errorf("Failed to remove CDI devices: %v", rErr)
+				}
+				fatalf("Failed to add mounts of CDI device %s: %v", cdiName, err)
+			}
+		}
 
 		logrus.Infof("add device to container %q successfully", name)
 		return
@@ -137,12 +232,21 @@ var rmDevCommand = cli.Command{
 	ArgsUsage: `<container_id> hostdevice[:containerdevice] [hostdevice[:containerdevice] ...]`,
 	Description: `You can remove mutiple host devices from container.
 You can assign hostdevice an empty value, though either of hostdevice and containerdevice should be assigned.
-The program will error out when the container device does not exist.`,
+The program will error out when the container device does not exist.
+The device is not removed if it or its partitions are mounted in container, unless --umount or --force is set.`,
 	Flags: []cli.Flag{
 		cli.BoolFlag{
 			Name:  "follow-partition",
 			Usage: "If disk is a base device, will remove all the sub partitions from container",
 		},
+		cli.StringFlag{
+			Name:  "umount",
+			Usage: "Unmount the filesystems on the device in container before removing it, 'lazy' or 'regular'",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Remove the device even if it's mounted in container",
+		},
 	},
 	Action: func(context *cli.Context) {
 		if context.NArg() < 2 {
@@ -163,8 +267,17 @@ The program will error out when the container device does not exist.`,
 			fatal(err)
 		}
 
+		opts := &types.RemoveDeviceOptions{
+			FollowPartition: context.Bool("follow-partition"),
+			Umount:          context.String("umount"),
+			Force:           context.Bool("force"),
+		}
+		if opts.Umount != "" && opts.Umount != types.UmountLazy && opts.Umount != types.UmountRegular {
+			fatalf("invalid umount mode: %s, 'lazy' or 'regular' is supported", opts.Umount)
+		}
+
 		// handle remove device here
-		if err = libdevice.RemoveDevice(c, devices, context.Bool("follow-partition")); err != nil {
+		if err = libdevice.RemoveDevice(c, devices, opts); err != nil {
 			fatalf("Failed to remove device: %v", err)
 		}
 		logrus.Infof("remove device from container %q successfully", name)
@@ -172,6 +285,66 @@ The program will error out when the container device does not exist.`,
 	},
 }
 
+var moveDevCommand = cli.Command{
+	Name:      "move-device",
+	Usage:     "move one or more devices from one container to another",
+	ArgsUsage: `<from_container> <to_container> hostdevice[:containerdevice] [hostdevice[:containerdevice] ...]`,
+	Description: `You can move mutiple devices added by syscontainer-tools from one container to another.
+The device is removed from the source container, including its node, cgroup permission, QoS and udev rules,
+and added to the target container with the same permissions. If containerdevice is not assigned,
+the path in the source container is used. The device is given back to the source container if failed to add
+it to the target container.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow-partition",
+			Usage: "If disk is a base device, will move all the sub partitions along with it",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "If device exists in target container, will cover the old file.",
+		},
+		cli.BoolFlag{
+			Name:  "force-unsafe",
+			Usage: "Move the block device even if it's mounted, used as swap or stacked by dm/md on host",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() < 3 {
+			fatalf("%s: %q requires a minimum of 3 args", os.Args[0], context.Command.Name)
+		}
+
+		from, err := container.New(context.Args()[0])
+		if err != nil {
+			fatal(err)
+		}
+		to, err := container.New(context.Args()[1])
+		if err != nil {
+			fatal(err)
+		}
+
+		var devices []*types.Device
+		for _, v := range context.Args()[2:] {
+			device, err := libdevice.ParseMapping(v)
+			if err != nil {
+				fatalf("Failed to parse device mapping: %s, %v", v, err)
+			}
+			if device.PathOnHost == "" {
+				fatalf("host device of %s should be assigned", v)
+			}
+			devices = append(devices, device)
+		}
+
+		opts := &types.AddDeviceOptions{
+			Force:       context.Bool("force"),
+			ForceUnsafe: context.Bool("force-unsafe"),
+		}
+		if err := libdevice.MoveDevice(from, to, devices, context.Bool("follow-partition"), opts); err != nil {
+			fatalf("Failed to move device: %v", err)
+		}
+		logrus.Infof("move device from container %q to container %q successfully", from.Name(), to.Name())
+	},
+}
+
 var listDevCommand = cli.Command{
 	Name:      "list-device",
 	Usage:     "list all devices in container",
@@ -267,6 +440,18 @@ var updateDevCommand = cli.Command{
 			Name:  "device-write-iops",
 			Usage: "Limit write rate (IO per second) to a device",
 		},
+		cli.BoolFlag{
+			Name:  "qos-on-slaves",
+			Usage: "Apply the blkio QOS of device-mapper device to the underlying physical disks",
+		},
+		cli.StringSliceFlag{
+			Name:  "permissions",
+			Usage: "Change cgroup permissions of an added device, eg: /dev/sdb:r or /dev/sdb:/dev/sdx:rw",
+		},
+		cli.BoolFlag{
+			Name:  "update-node",
+			Usage: "Also strip the read/write bits of node mode in container which are not allowed by new permissions",
+		},
 	},
 	Action: func(context *cli.Context) {
 		if context.NArg() < 1 {
@@ -290,8 +475,14 @@ var updateDevCommand = cli.Command{
 			fatal(err)
 		}
 
-		if len(readBps) == 0 && len(writeBps) == 0 && len(readIOPS) == 0 && len(writeIOPS) == 0 {
-			fatalf("update device should specify at least one device QOS configuration")
+		permDevices, err := parsePermissions(context.StringSlice("permissions"))
+		if err != nil {
+			fatal(err)
+		}
+
+		hasQos := len(readBps) != 0 || len(writeBps) != 0 || len(readIOPS) != 0 || len(writeIOPS) != 0
+		if !hasQos && len(permDevices) == 0 {
+			fatalf("update device should specify at least one device QOS configuration or permissions")
 		}
 
 		name := context.Args()[0]
@@ -300,11 +491,28 @@ var updateDevCommand = cli.Command{
 			fatal(err)
 		}
 
+		if len(permDevices) != 0 {
+			if err := setDevicesPath(c, permDevices); err != nil {
+				fatal(err)
+			}
+			if err = libdevice.UpdateDevicePermissions(c, permDevices, context.Bool("update-node")); err != nil {
+				fatalf("Failed to update device permissions: %v", err)
+			}
+			if !hasQos {
+				logrus.Infof("update device configure in container %q successfully", name)
+				return
+			}
+		}
+
 		opts := &types.AddDeviceOptions{
-			ReadBps:   readBps,
-			WriteBps:  writeBps,
-			ReadIOPS:  readIOPS,
-			WriteIOPS: writeIOPS,
+			QosOnSlaves: context.Bool("qos-on-slaves"),
+			ReadBps:     readBps,
+			WriteBps:    writeBps,
+			ReadIOPS:    readIOPS,
+			WriteIOPS:   writeIOPS,
+		}
+		if err := expandQosOptions(opts); err != nil {
+			fatal(err)
 		}
 
 		// handle add device here
@@ -317,6 +525,21 @@ var updateDevCommand = cli.Command{
 	},
 }
 
+// waitDevices waits for all the host devices in args to appear in the timeout.
+func waitDevices(context *cli.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for k := 1; k < context.NArg(); k++ {
+		device, err := libdevice.ParseMapping(context.Args()[k])
+		if err != nil {
+			return fmt.Errorf("Failed to parse device: %s, %v", context.Args()[k], err)
+		}
+		if err := libdevice.WaitDevice(device.PathOnHost, deadline.Sub(time.Now())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getDevices(context *cli.Context) ([]*types.Device, error) {
 	var devices []*types.Device
 	followPartition := context.Bool("follow-partition")
@@ -335,6 +558,11 @@ func getDevices(context *cli.Context) ([]*types.Device, error) {
 			continue
 		}
 
+		if libdevice.IsDmDevice(device) {
+			devices = appendDmDevices(devices, device, context)
+			continue
+		}
+
 		basedev, err := types.GetBaseDevName(device.PathOnHost)
 		if err != nil {
 			return nil, err
@@ -351,20 +579,83 @@ func getDevices(context *cli.Context) ([]*types.Device, error) {
 
 		if followPartition && devType == "disk" {
 			// Add sub-partition here
-			subDevices := libdevice.FindSubPartition(device)
-			for _, dev := range subDevices {
-				found := false
-				for _, eDev := range devices {
-					if dev.PathOnHost == eDev.PathOnHost {
-						found = true
-						break
-					}
-				}
-				if !found {
-					devices = append(devices, dev)
-				}
+			devices = appendUniqueDevices(devices, libdevice.FindSubPartition(device))
+		}
+		if context.Bool("follow-holders") {
+			devices = appendUniqueDevices(devices, libdevice.FindDmHolders(device))
+		}
+	}
+	return devices, nil
+}
+
+// appendDmDevices appends the device-mapper device(LVM, multipath, kpartx partition)
+// and its related devices according to the flags.
+func appendDmDevices(devices []*types.Device, device *types.Device, context *cli.Context) []*types.Device {
+	if info, err := libdevice.GetDmInfo(device); err == nil {
+		// dm-N may change after reboot, record the uuid to find it again.
+		device.DmUUID = info.UUID
+	}
+	// sysfs knows the stack exactly, do not guess by lsblk.
+	device.Parent = libdevice.GetDmParent(device)
+	devices = appendUniqueDevices(devices, []*types.Device{device})
+
+	if context.Bool("follow-partition") {
+		devices = appendUniqueDevices(devices, libdevice.FindDmPartitions(device))
+	}
+	if context.Bool("follow-slaves") {
+		devices = appendUniqueDevices(devices, libdevice.FindDmSlaves(device))
+	}
+	if context.Bool("follow-holders") {
+		devices = appendUniqueDevices(devices, libdevice.FindDmHolders(device))
+	}
+	return devices
+}
+
+func appendUniqueDevices(devices []*types.Device, newDevices []*types.Device) []*types.Device {
+	for _, dev := range newDevices {
+		found := false
+		for _, eDev := range devices {
+			if dev.PathOnHost == eDev.PathOnHost {
+				found = true
+				break
 			}
 		}
+		if !found {
+			devices = append(devices, dev)
+		}
+	}
+	return devices
+}
+
+// expandQosOptions moves the QOS of device-mapper devices to the physical disks under them,
+// blkio throttle on the dm device itself does not limit the IO of bio-based targets.
+func expandQosOptions(opts *types.AddDeviceOptions) error {
+	if !opts.QosOnSlaves {
+		return nil
+	}
+	for _, qosArr := range []*[]*types.Qos{&opts.ReadBps, &opts.WriteBps, &opts.ReadIOPS, &opts.WriteIOPS, &opts.BlkioWeight} {
+		expanded, err := libdevice.ExpandQosToPhysical(*qosArr)
+		if err != nil {
+			return err
+		}
+		*qosArr = expanded
+	}
+	return nil
+}
+
+// parsePermissions parses the device mappings with new permissions, which must be specified explicitly
+func parsePermissions(perms []string) ([]*types.Device, error) {
+	var devices []*types.Device
+	for _, perm := range perms {
+		arr := strings.Split(perm, ":")
+		if len(arr) < 2 || !libdevice.CheckDeviceMode(arr[len(arr)-1]) {
+			return nil, fmt.Errorf("invalid permissions: %s, permissions of device should be specified", perm)
+		}
+		device, err := libdevice.ParseMapping(perm)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse device mapping: %s, %v", perm, err)
+		}
+		devices = append(devices, device)
 	}
 	return devices, nil
 }
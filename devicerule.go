@@ -0,0 +1,164 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: cgroup-only device rule commands
+// Author: zhangwei
+// Create: 2018-01-18
+
+// go base main package
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/libdevice"
+	"isula.org/syscontainer-tools/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var addDevRuleCommand = cli.Command{
+	Name:      "add-device-rule",
+	Usage:     "allow container to access devices by cgroup rules without creating nodes",
+	ArgsUsage: `<container_id> "type major:minor permission" ["type major:minor permission" ...]`,
+	Description: `You can add mutiple cgroup device rules to container, eg: "c 136:* rwm".
+Type is c or b, major and minor could be "*" which means all numbers.
+The rules are persistent and will be applied again when container restarts.`,
+	Action: func(context *cli.Context) {
+		if context.NArg() < 2 {
+			fatalf("%s: %q requires a minimum of 2 args", os.Args[0], context.Command.Name)
+		}
+
+		rules, err := getDeviceRules(context, false)
+		if err != nil {
+			fatal(err)
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		if err = libdevice.AddDeviceRule(c, rules); err != nil {
+			fatalf("Failed to add device rule: %v", err)
+		}
+		logrus.Infof("add device rule to container %q successfully", name)
+	},
+}
+
+var rmDevRuleCommand = cli.Command{
+	Name:      "remove-device-rule",
+	Usage:     "remove cgroup device rules added by add-device-rule from container",
+	ArgsUsage: `<container_id> "type major:minor [permission]" ["type major:minor [permission]" ...]`,
+	Description: `You can remove mutiple cgroup device rules from container.
+The rule is identified by type and device number, permission is ignored.`,
+	Action: func(context *cli.Context) {
+		if context.NArg() < 2 {
+			fatalf("%s: %q requires a minimum of 2 args", os.Args[0], context.Command.Name)
+		}
+
+		rules, err := getDeviceRules(context, true)
+		if err != nil {
+			fatal(err)
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		if err = libdevice.RemoveDeviceRule(c, rules); err != nil {
+			fatalf("Failed to remove device rule: %v", err)
+		}
+		logrus.Infof("remove device rule from container %q successfully", name)
+	},
+}
+
+var listDevRuleCommand = cli.Command{
+	Name:      "list-device-rule",
+	Usage:     "list all cgroup device rules added by add-device-rule",
+	ArgsUsage: `<container_id>`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "pretty, p",
+			Usage: "If this flag is set, list rules in pretty json form",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() < 1 {
+			fatalf("%s: %q must accept a container-id", os.Args[0], context.Command.Name)
+		}
+		if context.NArg() > 1 {
+			fatalf("Don't put container-id in the middle of options")
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		rules, err := libdevice.ListDeviceRule(c)
+		if err != nil {
+			fatalf("Failed to list device rule in container: %v", err)
+		}
+		if len(rules) == 0 {
+			logrus.Infof("list device rule in container %q successfully", name)
+			return
+		}
+
+		rulesData, err := json.Marshal(rules)
+		if err != nil {
+			fatalf("failed to Marshal device rule config: %v", err)
+		}
+		rulesBuffer := new(bytes.Buffer)
+		if _, err = rulesBuffer.Write(rulesData); err != nil {
+			fatalf("Buffer Write error %v", err)
+		}
+
+		if context.Bool("pretty") {
+			rulesBuffer.Truncate(0)
+			if json.Indent(rulesBuffer, rulesData, "", "\t") != nil {
+				fatalf("failed to Indent device rule data: %v", err)
+			}
+		}
+
+		if _, err = rulesBuffer.WriteString("\n"); err != nil {
+			fatalf("Buffer WriteString error %v", err)
+		}
+		if _, err := os.Stdout.Write(rulesBuffer.Bytes()); err != nil {
+			logrus.Errorf("Write rulesBuffer error %v", err)
+		}
+		logrus.Infof("list device rule in container %q successfully", name)
+	},
+}
+
+func getDeviceRules(context *cli.Context, ignorePermission bool) ([]*types.Device, error) {
+	var rules []*types.Device
+	for k := 1; k < context.NArg(); k++ {
+		v := context.Args()[k]
+		if ignorePermission && len(strings.Fields(v)) == 2 {
+			v = v + " rwm"
+		}
+		rule, err := libdevice.ParseDeviceRule(v)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse device rule: %s, %v", context.Args()[k], err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
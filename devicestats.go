@@ -0,0 +1,155 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: device io statistics command
+// Author: zhangwei
+// Create: 2018-01-18
+
+// go base main package
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/libdevice"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var devStatsCommand = cli.Command{
+	Name:      "device-stats",
+	Usage:     "show io statistics of block devices added to container",
+	ArgsUsage: `<container_id>`,
+	Description: `This command shows the io counters of block devices added by syscontainer-tools,
+read from blkio cgroup(v1) or io.stat(v2) of the container, along with the QoS limits configured.
+With --watch, the read/write rates of each interval are shown instead, until interrupted.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "watch, w",
+			Usage: "Keep showing the read/write rates every interval",
+		},
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: 2 * time.Second,
+			Usage: "Interval of --watch",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Show the statistics in json form, not supported with --watch",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() != 1 {
+			fatalf("%s: %q must accept a container-id", os.Args[0], context.Command.Name)
+		}
+		interval := context.Duration("interval")
+		if context.Bool("watch") && (context.Bool("json") || interval <= 0) {
+			fatalf("--watch requires a positive interval and table output")
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		stats, err := libdevice.GetDeviceStats(c)
+		if err != nil {
+			fatalf("Failed to get device stats: %v", err)
+		}
+
+		if context.Bool("json") {
+			data, err := json.MarshalIndent(stats, "", "\t")
+			if err != nil {
+				fatalf("failed to Marshal device stats: %v", err)
+			}
+			fmt.Fprintln(os.Stdout, string(data))
+			return
+		}
+		if !context.Bool("watch") {
+			printDeviceStats(stats)
+			return
+		}
+
+		last, lastTime := stats, time.Now()
+		for {
+			time.Sleep(interval)
+			stats, err := libdevice.GetDeviceStats(c)
+			if err != nil {
+				fatalf("Failed to get device stats: %v", err)
+			}
+			now := time.Now()
+			fmt.Fprintf(os.Stdout, "%s\n", now.Format(time.RFC3339))
+			printDeviceRates(last, stats, now.Sub(lastTime))
+			fmt.Fprintln(os.Stdout)
+			last, lastTime = stats, now
+		}
+	},
+}
+
+func limitString(limit string) string {
+	if limit == "" {
+		return "-"
+	}
+	return limit
+}
+
+func printDeviceStats(stats []*libdevice.DeviceStats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST-DEVICE\tCONTAINER-DEVICE\tREAD-BYTES\tWRITE-BYTES\tREAD-IOS\tWRITE-IOS\tREAD-BPS-LIMIT\tWRITE-BPS-LIMIT\tREAD-IOPS-LIMIT\tWRITE-IOPS-LIMIT")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", s.PathOnHost, s.PathInContainer,
+			s.ReadBytes, s.WriteBytes, s.ReadIOs, s.WriteIOs,
+			limitString(s.ReadBpsLimit), limitString(s.WriteBpsLimit), limitString(s.ReadIOPSLimit), limitString(s.WriteIOPSLimit))
+	}
+	w.Flush()
+	logrus.Infof("show device stats successfully")
+}
+
+// rate returns the increase per second of counter, or 0 if counter is reset.
+func rate(old, new uint64, elapsed time.Duration) uint64 {
+	if new < old || elapsed <= 0 {
+		return 0
+	}
+	return uint64(float64(new-old) / elapsed.Seconds())
+}
+
+func printDeviceRates(last, stats []*libdevice.DeviceStats, elapsed time.Duration) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST-DEVICE\tCONTAINER-DEVICE\tREAD-BPS\tWRITE-BPS\tREAD-IOPS\tWRITE-IOPS")
+	for _, s := range stats {
+		// device added during the interval has no rate yet.
+		old := s
+		for _, l := range last {
+			if l.Major == s.Major && l.Minor == s.Minor {
+				old = l
+				break
+			}
+		}
+		// rate/limit, the limit is shown when configured.
+		withLimit := func(v uint64, limit string) string {
+			if limit == "" {
+				return fmt.Sprintf("%d", v)
+			}
+			return fmt.Sprintf("%d/%s", v, limit)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.PathOnHost, s.PathInContainer,
+			withLimit(rate(old.ReadBytes, s.ReadBytes, elapsed), s.ReadBpsLimit),
+			withLimit(rate(old.WriteBytes, s.WriteBytes, elapsed), s.WriteBpsLimit),
+			withLimit(rate(old.ReadIOs, s.ReadIOs, elapsed), s.ReadIOPSLimit),
+			withLimit(rate(old.WriteIOs, s.WriteIOs, elapsed), s.WriteIOPSLimit))
+	}
+	w.Flush()
+}
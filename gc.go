@@ -0,0 +1,215 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: garbage collection command
+// Author: zhangwei
+// Create: 2018-01-18
+
+// go base main package
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/libnetwork"
+	"isula.org/syscontainer-tools/pkg/udevd"
+	"isula.org/syscontainer-tools/utils"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var gcCommand = cli.Command{
+	Name:  "gc",
+	Usage: "clean up the resources left by containers which no longer exist",
+	Description: `This command cleans up the resources left on host by crashes or failures of poststop hook,
+for containers which no longer exist: transfer mounts of add-path under /.sharedpath, network namespace
+pins under /run/syscontainer-tools/netns along with the veths in them, and udev rules.
+Resources of existing containers are never touched, it's safe to run it periodically.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only show the resources to clean up",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() != 0 {
+			fatalf("%s: %q does not accept any args", os.Args[0], context.Command.Name)
+		}
+		// without the container storage, all resources look orphaned, refuse to clean them.
+		storagePath, err := utils.GetContainerStoragePath()
+		if err != nil {
+			fatalf("Failed to find container storage: %v", err)
+		}
+		gc := &garbageCollector{storagePath: storagePath, dryRun: context.Bool("dry-run")}
+
+		gc.cleanTransferPaths()
+		gc.cleanNetnsPins()
+		gc.cleanUdevRules()
+		if len(gc.errs) != 0 {
+			fatal(errors.New(strings.Trim(fmt.Sprint(gc.errs), "[]")))
+		}
+		logrus.Infof("gc done, %d resources cleaned", gc.cleaned)
+	},
+}
+
+// containerIDLen is the length of full container id
+const containerIDLen = 64
+
+type garbageCollector struct {
+	storagePath string
+	dryRun      bool
+	cleaned     int
+	errs        []error
+}
+
+// orphaned checks if the container no longer exists
+func (gc *garbageCollector) orphaned(id string) bool {
+	if id == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(gc.storagePath, id))
+	return os.IsNotExist(err)
+}
+
+// resolveID resolves the truncated container id to the full id by the containers in storage path,
+// it returns the number of matched containers too, the id is resolved only if exactly one matches.
+func (gc *garbageCollector) resolveID(id string) (string, int, error) {
+	files, err := ioutil.ReadDir(gc.storagePath)
+	if err != nil {
+		return "", 0, err
+	}
+	var full string
+	matched := 0
+	for _, f := range files {
+		if !f.IsDir() || !strings.HasPrefix(f.Name(), id) {
+			continue
+		}
+		full = f.Name()
+		matched++
+	}
+	if matched != 1 {
+		return "", matched, nil
+	}
+	return full, matched, nil
+}
+
+// clean runs fn to clean up the resource, or just shows it with --dry-run.
+func (gc *garbageCollector) clean(what string, fn func() error) {
+	if gc.dryRun {
+		fmt.Fprintf(os.Stdout, "Would remove %s.\n", what)
+		return
+	}
+	if err := fn(); err != nil {
+		gc.errs = append(gc.errs, fmt.Errorf("failed to remove %s: %v", what, err))
+		return
+	}
+	gc.cleaned++
+	fmt.Fprintf(os.Stdout, "Remove %s done.\n", what)
+	logrus.Infof("Remove %s done", what)
+}
+
+func (gc *garbageCollector) cleanTransferPaths() {
+	ids, err := utils.ListTransferIDs()
+	if err != nil {
+		gc.errs = append(gc.errs, err)
+		return
+	}
+	for _, id := range ids {
+		if !gc.orphaned(id) {
+			continue
+		}
+		gc.clean(fmt.Sprintf("transfer paths of container %s", id), func() error {
+			return utils.CleanTransferPath(id)
+		})
+	}
+}
+
+func (gc *garbageCollector) cleanNetnsPins() {
+	files, err := ioutil.ReadDir(hconfig.IsuladToolsDirNetns)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			gc.errs = append(gc.errs, err)
+		}
+		return
+	}
+	for _, f := range files {
+		id := f.Name()
+		if !gc.orphaned(id) {
+			continue
+		}
+		pin := filepath.Join(hconfig.IsuladToolsDirNetns, id)
+		if gc.dryRun {
+			if veths, err := libnetwork.ReleaseNetns(pin, true); err == nil && len(veths) != 0 {
+				fmt.Fprintf(os.Stdout, "Would remove veths %s of container %s.\n", strings.Join(veths, ","), id)
+			}
+		}
+		gc.clean(fmt.Sprintf("network namespace pin of container %s", id), func() error {
+			veths, err := libnetwork.ReleaseNetns(pin, false)
+			if len(veths) != 0 {
+				logrus.Infof("Removed veths %s of container %s", strings.Join(veths, ","), id)
+			}
+			return err
+		})
+	}
+}
+
+func (gc *garbageCollector) cleanUdevRules() {
+	rules, err := udevd.LoadAllRules()
+	if err != nil {
+		gc.errs = append(gc.errs, err)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		id := r.Container
+		if id != "" && len(id) < containerIDLen {
+			// rules of the legacy global file carry truncated ids, resolve them before checking.
+			// The ones matching no container are orphaned, they are removed from the legacy file by
+			// the controller of the truncated id. The ambiguous ones may belong to living containers.
+			full, matched, err := gc.resolveID(id)
+			if err != nil {
+				gc.errs = append(gc.errs, err)
+				return
+			}
+			if matched > 1 {
+				logrus.Debugf("Skip udev rule %s of container %s: id matches %d containers", r.Name, r.Container, matched)
+				continue
+			}
+			if matched == 1 {
+				id = full
+			}
+		}
+		if seen[id] || !gc.orphaned(id) {
+			continue
+		}
+		seen[id] = true
+		gc.clean(fmt.Sprintf("udev rules of container %s", id), func() error {
+			ctrl := udevd.NewUdevdController(id)
+			if err := ctrl.Lock(); err != nil {
+				return err
+			}
+			defer ctrl.Unlock()
+			if err := ctrl.LoadRules(); err != nil {
+				return err
+			}
+			// Rules shares the slice with controller, copy it before removing.
+			for _, rule := range append([]*udevd.Rule{}, ctrl.Rules()...) {
+				ctrl.RemoveRule(rule)
+			}
+			return ctrl.ToDisk()
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: garbage collection tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGcOrphaned(t *testing.T) {
+	storage, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storage)
+
+	alive := "abcdef01" + strings.Repeat("1", containerIDLen-8)
+	twin1 := "12345678" + strings.Repeat("1", containerIDLen-8)
+	twin2 := "12345678" + strings.Repeat("2", containerIDLen-8)
+	for _, id := range []string{alive, twin1, twin2} {
+		if err := os.Mkdir(filepath.Join(storage, id), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gc := &garbageCollector{storagePath: storage}
+
+	tests := []struct {
+		id       string
+		full     string
+		matched  int
+		orphaned bool
+	}{
+		{alive[:8], alive, 1, false},
+		// ambiguous ids are never cleaned.
+		{twin1[:8], "", 2, false},
+		// no container matches the truncated id.
+		{"deadbeef", "", 0, true},
+	}
+	for _, tt := range tests {
+		full, matched, err := gc.resolveID(tt.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if full != tt.full || matched != tt.matched {
+			t.Errorf("resolveID(%s) = %s, %d, want %s, %d", tt.id, full, matched, tt.full, tt.matched)
+		}
+		// the same as cleanUdevRules, ids are checked after resolved.
+		id := tt.id
+		if matched == 1 {
+			id = full
+		}
+		if matched <= 1 && gc.orphaned(id) != tt.orphaned {
+			t.Errorf("orphaned(%s) = %v, want %v", id, !tt.orphaned, tt.orphaned)
+		}
+	}
+
+	if gc.orphaned(alive) {
+		t.Errorf("container %s exists, should not be orphaned", alive)
+	}
+	if !gc.orphaned(strings.Repeat("f", containerIDLen)) {
+		t.Errorf("container not in storage should be orphaned")
+	}
+	if gc.orphaned("") {
+		t.Errorf("empty id should not be orphaned")
+	}
+}
@@ -153,6 +153,7 @@ func main() {
 	flMode := flag.String("state", "", "set syscontainer hook state mode: prestart or poststop")
 	// No requirements at present, by default don't enable this function.
 	flWithRelabel := flag.Bool("with-relabel", false, "syscontainer hook enable oci relabel hook function")
+	flag.DurationVar(&deviceWaitTimeout, "device-wait", 0, "wait for the devices to appear on host before adding them to container, eg: 30s")
 
 	flag.Parse()
 
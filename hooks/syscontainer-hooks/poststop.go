@@ -35,7 +35,7 @@ import (
 
 // RemoveUdevRule will remove device udev rule for the stopped container
 func RemoveUdevRule(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
-	udevdCtrl := udevd.NewUdevdController()
+	udevdCtrl := udevd.NewUdevdController(state.ID)
 	if err := udevdCtrl.Lock(); err != nil {
 		return err
 	}
@@ -136,15 +136,37 @@ func RemoveSharedPath(state *configs.HookState, hookConfig *hconfig.ContainerHoo
 		}
 
 	}
+	for _, m := range hookConfig.Mounts {
+		if !m.Transfer {
+			continue
+		}
+		if err := utils.RemoveTransferMount(state.ID, m.Destination); err != nil {
+			logrus.Errorf("RemoveSharedPath failed: Mount: %v failed: %s", m, err)
+			continue
+		}
+		if err := libdevice.ReleaseMountDevice(state.ID, m); err != nil {
+			logrus.Errorf("RemoveSharedPath failed: release device of mount %v failed: %s", m, err)
+		}
+	}
 	utils.RemoveContainerSpecPath(state.ID)
 	return nil
 
 }
 
+// ReleaseVolumes will release the loop devices of volumes after container stop.
+func ReleaseVolumes(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
+	for _, v := range hookConfig.Volumes {
+		if err := libdevice.DetachVolume(state.ID, v); err != nil {
+			logrus.Errorf("ReleaseVolumes failed: Volume: %v failed: %s", v, err)
+		}
+	}
+	return nil
+}
+
 // prestartHook is the main logic of device hook
 func postStopHook(data *hookData, withRelabel bool) {
 	var actions []HookAction
-	actions = []HookAction{RemoveUdevRule, RemoveNetworkDevices, RemoveSharedPath}
+	actions = []HookAction{RemoveUdevRule, RemoveNetworkDevices, ReleaseVolumes, RemoveSharedPath}
 	if withRelabel {
 		actions = append(actions, PostStopRelabel)
 	}
@@ -22,6 +22,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/opencontainers/runc/libcontainer/configs"
 	_ "github.com/opencontainers/runc/libcontainer/nsenter"
@@ -32,11 +33,15 @@ import (
 	"isula.org/syscontainer-tools/libdevice"
 	"isula.org/syscontainer-tools/libdevice/nsexec"
 	"isula.org/syscontainer-tools/libnetwork"
+	"isula.org/syscontainer-tools/pkg/cdi"
 	"isula.org/syscontainer-tools/pkg/udevd"
 	"isula.org/syscontainer-tools/types"
 	"isula.org/syscontainer-tools/utils"
 )
 
+// deviceWaitTimeout is the total time to wait for late devices on container start, 0 means no wait.
+var deviceWaitTimeout time.Duration
+
 const (
 	arrayLen = 3 // calc path for bind array len
 	minor    = 7 // runcDevice Minor
@@ -68,6 +73,25 @@ func calcPathForBind(rootfs string, bind string) (string, error) {
 	return strings.Join(paths, ":"), nil
 }
 
+// resolveCDIDevice finds the host node of the device in CDI specs
+func resolveCDIDevice(dev *hconfig.DeviceMapping) (string, error) {
+	edits, err := cdi.Resolve(dev.CDIDevice)
+	if err != nil {
+		return "", err
+	}
+	for _, node := range edits.DeviceNodes {
+		if filepath.Clean(node.Path) != dev.PathInContainer {
+			continue
+		}
+		device, err := libdevice.CDIDeviceNode(dev.CDIDevice, node)
+		if err != nil {
+			return "", err
+		}
+		return device.PathOnHost, nil
+	}
+	return "", fmt.Errorf("device %s is not found in CDI device %s", dev.PathInContainer, dev.CDIDevice)
+}
+
 // AddDevices will add devices to the container
 func AddDevices(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
 	pid := strconv.Itoa(state.Pid)
@@ -77,7 +101,7 @@ func AddDevices(state *configs.HookState, hookConfig *hconfig.ContainerHookConfi
 	if err != nil {
 		return err
 	}
-	udevdCtrl := udevd.NewUdevdController()
+	udevdCtrl := udevd.NewUdevdController(state.ID)
 	if err := udevdCtrl.Lock(); err != nil {
 		return err
 	}
@@ -90,16 +114,56 @@ func AddDevices(state *configs.HookState, hookConfig *hconfig.ContainerHookConfi
 		logrus.Infof("Start sync rules to disk")
 		udevdCtrl.ToDisk()
 		logrus.Infof("Finish sync rules to disk")
+		// the rules are kept after host reboots, but the watcher consuming them is not.
+		if err := udevdCtrl.EnsureWatcher(); err != nil {
+			logrus.Errorf("[device-hook] Failed to start uevent watcher: %v", err)
+		}
 	}()
 
+	waitDeadline := time.Now().Add(deviceWaitTimeout)
 	for index, dev := range hookConfig.Devices {
+		if deviceWaitTimeout > 0 && dev.DmUUID == "" {
+			if err := libdevice.WaitDevice(dev.PathOnHost, waitDeadline.Sub(time.Now())); err != nil {
+				logrus.Errorf("[device-hook] Add device (%s) failed: %v", dev.PathOnHost, err)
+				return err
+			}
+		}
 		// re-calc the dest path of device.
 		resolvDev := calcPathForDevice(state.Root, dev)
+		// dm-N of device-mapper device may change after reboot, find it by uuid.
+		if dev.DmUUID != "" {
+			node, err := libdevice.FindDmDeviceByUUID(dev.DmUUID)
+			if err != nil {
+				logrus.Errorf("[device-hook] Add device (%s) failed: %v", dev.PathOnHost, err)
+				return err
+			}
+			mapping := *dev
+			mapping.PathOnHost = node
+			resolvDev = calcPathForDevice(state.Root, &mapping)
+		}
+		// host node of CDI device is described by the spec, which may be changed by vendor.
+		if dev.CDIDevice != "" {
+			node, err := resolveCDIDevice(dev)
+			if err != nil {
+				logrus.Errorf("[device-hook] Add device (%s) failed: %v", dev.PathOnHost, err)
+				return err
+			}
+			if node != dev.PathOnHost {
+				hookConfig.Devices[index].PathOnHost = node
+				hookConfig.SetConfigDirty()
+			}
+			resolvDev = calcPathForDevice(state.Root, dev)
+		}
 		device, err := libdevice.ParseDevice(resolvDev)
 		if err != nil {
 			logrus.Errorf("[device-hook] Add device (%s), parse device failed: %v", resolvDev, err)
 			return err
 		}
+		device.NodeAttr = dev.NodeAttr
+		if dev.DiskLinks {
+			device.DiskLinks = true
+			device.LinkPaths = libdevice.FindDiskLinks(device, filepath.Join(state.Root, "/dev"))
+		}
 
 		// update config here
 		if dev.Major != device.Major || dev.Minor != device.Minor {
@@ -123,11 +187,19 @@ func AddDevices(state *configs.HookState, hookConfig *hconfig.ContainerHookConfi
 		}
 
 		// use exec driver to add device.
-		libdevice.UpdateDeviceOwner(spec, device)
-		if err = driver.AddDevice(pid, device, true); err != nil {
+		if err := libdevice.UpdateDeviceOwner(spec, device); err != nil {
 			logrus.Errorf("[device-hook] Add device (%s) failed: %v", resolvDev, err)
 			return err
 		}
+		device.BindNode = dev.BindNode
+		if err = libdevice.AddDeviceNode(driver, spec, pid, state.Root, state.ID, device, true); err != nil {
+			logrus.Errorf("[device-hook] Add device (%s) failed: %v", resolvDev, err)
+			return err
+		}
+		if device.BindNode != dev.BindNode {
+			hookConfig.Devices[index].BindNode = device.BindNode
+			hookConfig.SetConfigDirty()
+		}
 
 		// update cgroup access permission.
 		if err = libdevice.UpdateCgroupPermission(cgroupPath, device, true); err != nil {
@@ -138,6 +210,30 @@ func AddDevices(state *configs.HookState, hookConfig *hconfig.ContainerHookConfi
 	return nil
 }
 
+// AddDeviceRules will add the cgroup-only device rules to the container
+func AddDeviceRules(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
+	if len(hookConfig.DeviceRules) == 0 {
+		return nil
+	}
+	pid := strconv.Itoa(state.Pid)
+	cgroupPath, err := libdevice.FindCgroupPath(pid, "devices", spec.Linux.CgroupsPath)
+	if err != nil {
+		return err
+	}
+	for _, r := range hookConfig.DeviceRules {
+		rule, err := libdevice.ParseDeviceRule(r)
+		if err != nil {
+			logrus.Errorf("[device-hook] parse device rule error, %s, skipping", err)
+			continue
+		}
+		if err := libdevice.UpdateCgroupPermission(cgroupPath, rule, true); err != nil {
+			logrus.Errorf("[device-hook] Add device rule (%s) failed: %v", r, err)
+			return err
+		}
+	}
+	return nil
+}
+
 // AddBinds will add the binds to the container
 func AddBinds(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
 	pid := strconv.Itoa(state.Pid)
@@ -149,6 +245,7 @@ func AddBinds(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig,
 			logrus.Errorf("[device-hook] parse bind error, %s, skipping", err)
 			continue
 		}
+		bind.UsernsPath = utils.GetUsernsPath(spec, state.Pid)
 		// re-calc the bind dest path, because we have not done the chroot
 		if err := utils.PrepareTransferPath(state.Root, state.ID, bind, true); err != nil {
 			logrus.Errorf("[device-hook] Prepare tansfer path (%s) failed, prepare tansfer path failed: %v", bindstr, err)
@@ -162,6 +259,60 @@ func AddBinds(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig,
 	return nil
 }
 
+// AttachVolumes will attach the volume images to loop devices, and mount the filesystems
+// to the container, the exposed block devices are added by AddDevices.
+func AttachVolumes(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
+	pid := strconv.Itoa(state.Pid)
+	driver := nsexec.NewDefaultNsDriver()
+
+	for _, v := range hookConfig.Volumes {
+		device, err := libdevice.AttachVolume(state.ID, v)
+		if err != nil {
+			logrus.Errorf("[device-hook] Attach volume (%s) failed: %v", v.Image, err)
+			return err
+		}
+		if device != v.LoopDevice {
+			// loop device is changed, update the device exposed to container.
+			for _, dev := range hookConfig.Devices {
+				if v.Device != "" && dev.PathInContainer == v.Device {
+					dev.PathOnHost = device
+				}
+			}
+			v.LoopDevice = device
+			hookConfig.SetConfigDirty()
+		}
+		if v.Path == "" {
+			continue
+		}
+		// we have not done the chroot, mount under the rootfs
+		if err := libdevice.MountInContainer(driver, spec, pid, state.Root, state.ID, libdevice.VolumeMount(v)); err != nil {
+			logrus.Errorf("[device-hook] Mount volume (%s) failed: %v", v, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// AddMounts will mount the filesystems added by add-mount to the container
+func AddMounts(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
+	pid := strconv.Itoa(state.Pid)
+	driver := nsexec.NewDefaultNsDriver()
+
+	for _, m := range hookConfig.Mounts {
+		if err := libdevice.AcquireMountDevice(state.ID, m); err != nil {
+			logrus.Errorf("[device-hook] Add mount (%s) failed: %v", m, err)
+			continue
+		}
+		// we have not done the chroot, mount under the rootfs
+		if err := libdevice.MountInContainer(driver, spec, pid, state.Root, state.ID, m); err != nil {
+			logrus.Errorf("[device-hook] Add mount (%s) failed: %v", m, err)
+			libdevice.ReleaseMountDevice(state.ID, m)
+			continue
+		}
+	}
+	return nil
+}
+
 // SharePath will add the binds to the container
 func SharePath(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig, spec *specs.Spec) error {
 	pid := strconv.Itoa(state.Pid)
@@ -192,7 +343,7 @@ func UpdateQos(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig
 			return err
 		}
 
-		if err := libdevice.UpdateCgroupDeviceReadIOPS(pid, innerPath, devReadIOPS.String()); err != nil {
+		if err := libdevice.UpdateCgroupDeviceReadIOPS(pid, innerPath, hconfig.StrictestQos(hookConfig.ReadIOPS, devReadIOPS.Major, devReadIOPS.Minor).String()); err != nil {
 			logrus.Errorf("[device-hook] Failed to update device read iops (%s) for container %s: %v", devReadIOPS.String(), state.ID, err)
 			return err
 		}
@@ -203,7 +354,7 @@ func UpdateQos(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig
 			return err
 		}
 
-		if err := libdevice.UpdateCgroupDeviceWriteIOPS(pid, innerPath, devWriteIOPS.String()); err != nil {
+		if err := libdevice.UpdateCgroupDeviceWriteIOPS(pid, innerPath, hconfig.StrictestQos(hookConfig.WriteIOPS, devWriteIOPS.Major, devWriteIOPS.Minor).String()); err != nil {
 			logrus.Errorf("[device-hook] Failed to update device write iops (%s) for container %s: %v", devWriteIOPS, state.ID, err)
 			return err
 		}
@@ -214,7 +365,7 @@ func UpdateQos(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig
 			return err
 		}
 
-		if err := libdevice.UpdateCgroupDeviceReadBps(pid, innerPath, devReadBps.String()); err != nil {
+		if err := libdevice.UpdateCgroupDeviceReadBps(pid, innerPath, hconfig.StrictestQos(hookConfig.ReadBps, devReadBps.Major, devReadBps.Minor).String()); err != nil {
 			logrus.Errorf("[device-hook] Failed to update device read bps (%s) for container %s: %v", devReadBps.String(), state.ID, err)
 			return err
 		}
@@ -225,7 +376,7 @@ func UpdateQos(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig
 			return err
 		}
 
-		if err := libdevice.UpdateCgroupDeviceWriteBps(pid, innerPath, devWriteBps.String()); err != nil {
+		if err := libdevice.UpdateCgroupDeviceWriteBps(pid, innerPath, hconfig.StrictestQos(hookConfig.WriteBps, devWriteBps.Major, devWriteBps.Minor).String()); err != nil {
 			logrus.Errorf("[device-hook] Failed to update device write bps (%s) for container %s: %v", devWriteBps.String(), state.ID, err)
 			return err
 		}
@@ -236,7 +387,7 @@ func UpdateQos(state *configs.HookState, hookConfig *hconfig.ContainerHookConfig
 			return err
 		}
 
-		if err := libdevice.UpdateCgroupDeviceWeight(pid, innerPath, devBlkioWeight.String()); err != nil {
+		if err := libdevice.UpdateCgroupDeviceWeight(pid, innerPath, hconfig.StrictestQos(hookConfig.BlkioWeight, devBlkioWeight.Major, devBlkioWeight.Minor).String()); err != nil {
 			logrus.Errorf("[device-hook] Failed to update device weight %s for container %s : %v", devBlkioWeight.String(), state.ID, err)
 			return err
 		}
@@ -451,8 +602,11 @@ func prestartHook(data *hookData, withRelabel bool) error {
 	actions = []HookAction{
 		SharePath,
 		AdjustUserns,
+		AttachVolumes,
 		AddDevices,
+		AddDeviceRules,
 		AddBinds,
+		AddMounts,
 		UpdateQos,
 		UpdateNetwork,
 		DynLoadModule,
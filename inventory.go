@@ -0,0 +1,250 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: inventory command
+// Author: zhangwei
+// Create: 2018-01-18
+
+// go base main package
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/libdevice"
+	"isula.org/syscontainer-tools/types"
+	"isula.org/syscontainer-tools/utils"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// inventoryEntry is the resources added to a container by syscontainer-tools
+type inventoryEntry struct {
+	Container string                   `json:"container"`
+	Devices   []*hconfig.DeviceMapping `json:"devices,omitempty"`
+	Paths     []string                 `json:"paths,omitempty"`
+	Nics      []*types.InterfaceConf   `json:"nics,omitempty"`
+	Routes    []*types.Route           `json:"routes,omitempty"`
+}
+
+func (e *inventoryEntry) empty() bool {
+	return len(e.Devices) == 0 && len(e.Paths) == 0 && len(e.Nics) == 0 && len(e.Routes) == 0
+}
+
+type inventoryFilter struct {
+	device    string
+	devType   string
+	devNumber string
+	path      string
+	bridge    string
+	ip        string
+}
+
+var inventoryCommand = cli.Command{
+	Name:  "inventory",
+	Usage: "list the devices, paths, network interfaces and routes added to all containers",
+	Description: `This command scans the config of all containers, and prints the resources added by syscontainer-tools.
+With filters, only the matched resources are printed.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "device",
+			Usage: "Only list the containers which the host device is added to",
+		},
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "Only list the containers which the host path or its sub paths are added to",
+		},
+		cli.StringFlag{
+			Name:  "bridge",
+			Usage: "Only list the network interfaces attached to the bridge",
+		},
+		cli.StringFlag{
+			Name:  "ip",
+			Usage: "Only list the network interfaces and routes with the ip",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: "Output format: table or json",
+		},
+	},
+	Action: func(context *cli.Context) {
+		format := context.String("format")
+		if format != "table" && format != "json" {
+			fatalf("unknown format %q, table or json is supported", format)
+		}
+
+		filter := &inventoryFilter{
+			device: context.String("device"),
+			path:   context.String("path"),
+			bridge: context.String("bridge"),
+			ip:     context.String("ip"),
+		}
+		if filter.device != "" {
+			filter.device = filepath.Clean(filter.device)
+			// match by device number too, the device may be added by another name.
+			if dev, err := libdevice.DeviceFromPath(filter.device, ""); err == nil {
+				filter.devType = dev.Type
+				filter.devNumber = fmt.Sprintf("%d:%d", dev.Major, dev.Minor)
+			}
+		}
+		if filter.path != "" {
+			filter.path = filepath.Clean(filter.path)
+		}
+
+		entries, err := loadInventory(filter)
+		if err != nil {
+			fatalf("Failed to load inventory: %v", err)
+		}
+
+		if format == "json" {
+			data, err := json.MarshalIndent(entries, "", "\t")
+			if err != nil {
+				fatalf("failed to Marshal inventory: %v", err)
+			}
+			fmt.Fprintln(os.Stdout, string(data))
+		} else {
+			printInventoryTable(entries)
+		}
+		logrus.Infof("list inventory successfully")
+	},
+}
+
+func loadInventory(filter *inventoryFilter) ([]*inventoryEntry, error) {
+	entries := []*inventoryEntry{}
+	storagePath, err := utils.GetContainerStoragePath()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	// one broken config should not hide the resources of all the other containers.
+	configs, broken, err := hconfig.LoadReadableContainerHookConfigs(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	for id, err := range broken {
+		logrus.Warnf("Skip container %s in inventory: %v", id, err)
+		fmt.Fprintf(os.Stderr, "Warning: skip container %s: %v\n", id, err)
+	}
+
+	for id, hConfig := range configs {
+		entry := &inventoryEntry{Container: id}
+		if filter.bridge == "" && filter.ip == "" {
+			for _, dm := range hConfig.GetAllDevices() {
+				if filter.path == "" && filter.matchDevice(dm) {
+					entry.Devices = append(entry.Devices, dm)
+				}
+			}
+			for _, bind := range hConfig.GetBinds() {
+				if filter.device == "" && filter.matchPath(bind) {
+					entry.Paths = append(entry.Paths, bind)
+				}
+			}
+		}
+		if filter.device == "" && filter.path == "" {
+			for _, nic := range hConfig.GetNics(nil) {
+				if filter.matchNic(nic) {
+					entry.Nics = append(entry.Nics, nic)
+				}
+			}
+			if filter.bridge == "" {
+				for _, route := range hConfig.GetRoutes(nil) {
+					if filter.matchRoute(route) {
+						entry.Routes = append(entry.Routes, route)
+					}
+				}
+			}
+		}
+		if !entry.empty() {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Container < entries[j].Container
+	})
+	return entries, nil
+}
+
+func (f *inventoryFilter) matchDevice(dm *hconfig.DeviceMapping) bool {
+	if f.device == "" {
+		return true
+	}
+	if dm.PathOnHost == f.device {
+		return true
+	}
+	return f.devNumber != "" && dm.Type == f.devType && fmt.Sprintf("%d:%d", dm.Major, dm.Minor) == f.devNumber
+}
+
+func (f *inventoryFilter) matchPath(bind string) bool {
+	if f.path == "" {
+		return true
+	}
+	hostPath := filepath.Clean(strings.SplitN(bind, ":", 2)[0])
+	return hostPath == f.path || strings.HasPrefix(hostPath, f.path+"/") || f.path == "/"
+}
+
+func ipAddress(ip string) string {
+	return strings.SplitN(ip, "/", 2)[0]
+}
+
+func (f *inventoryFilter) matchNic(nic *types.InterfaceConf) bool {
+	if f.bridge != "" && nic.Bridge != f.bridge {
+		return false
+	}
+	if f.ip != "" && ipAddress(nic.IP) != ipAddress(f.ip) {
+		return false
+	}
+	return true
+}
+
+func (f *inventoryFilter) matchRoute(route *types.Route) bool {
+	if f.ip == "" {
+		return true
+	}
+	ip := ipAddress(f.ip)
+	return ipAddress(route.Dest) == ip || route.Src == ip || route.Gw == ip
+}
+
+func printInventoryTable(entries []*inventoryEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tKIND\tHOST\tCONTAINER-SIDE\tDETAIL")
+	for _, e := range entries {
+		id := e.Container
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		for _, dm := range e.Devices {
+			fmt.Fprintf(w, "%s\tdevice\t%s\t%s\t%s %d:%d %s\n", id, dm.PathOnHost, dm.PathInContainer, dm.Type, dm.Major, dm.Minor, dm.CgroupPermissions)
+		}
+		for _, bind := range e.Paths {
+			arr := strings.SplitN(bind, ":", 3)
+			for len(arr) < 3 {
+				arr = append(arr, "")
+			}
+			fmt.Fprintf(w, "%s\tpath\t%s\t%s\t%s\n", id, arr[0], arr[1], arr[2])
+		}
+		for _, nic := range e.Nics {
+			fmt.Fprintf(w, "%s\tnic\t%s\t%s\t%s bridge=%s ip=%s\n", id, nic.HostNicName, nic.CtrNicName, nic.Type, nic.Bridge, nic.IP)
+		}
+		for _, route := range e.Routes {
+			fmt.Fprintf(w, "%s\troute\t-\t%s\tdest=%s src=%s gw=%s\n", id, route.Dev, route.Dest, route.Src, route.Gw)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: bind mount device node to container
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"isula.org/syscontainer-tools/libdevice/nsexec"
+	"isula.org/syscontainer-tools/types"
+	"isula.org/syscontainer-tools/utils"
+)
+
+// nodeBind returns the bind which mounts the host device node to container.
+// The node is owned by host, so owner and mode options do not work for it.
+func nodeBind(device *types.Device) *types.Bind {
+	return &types.Bind{
+		HostPath:      device.PathOnHost,
+		ContainerPath: device.Path,
+		MountOption:   "rw",
+		UID:           int(device.UID),
+		GID:           int(device.GID),
+	}
+}
+
+// AddDeviceNode creates the device node in container.
+// If mknod is not permitted (EPERM) in the user namespace of container, bind mount the host node
+// through the transfer path instead, device.BindNode is set in this case. Other errors, such as
+// the path already exists without force, are returned as is.
+func AddDeviceNode(driver nsexec.NsDriver, spec *specs.Spec, pid, rootfs, id string, device *types.Device, force bool) error {
+	if device.BindNode {
+		return addNodeBind(driver, pid, rootfs, id, device)
+	}
+	err := driver.AddDevice(pid, device, force)
+	if err == nil || spec == nil || !strings.HasPrefix(err.Error(), errMknodNotPermitted) {
+		return err
+	}
+	if uid, _ := utils.GetUIDGid(spec); uid == -1 {
+		return err
+	}
+	logrus.Warnf("Failed to mknod device %s in container %s: %v, try to bind mount it", device.Path, id, err)
+	if bErr := addNodeBind(driver, pid, rootfs, id, device); bErr != nil {
+		logrus.Errorf("Failed to bind mount device %s to container %s: %v", device.PathOnHost, id, bErr)
+		return err
+	}
+	device.BindNode = true
+	return nil
+}
+
+func addNodeBind(driver nsexec.NsDriver, pid, rootfs, id string, device *types.Device) error {
+	bind := nodeBind(device)
+	if err := utils.PrepareTransferPath(rootfs, id, bind, true); err != nil {
+		utils.RemoveTransferPath(id, bind)
+		return err
+	}
+	if err := driver.AddBind(pid, bind); err != nil {
+		utils.RemoveTransferPath(id, bind)
+		return err
+	}
+	return nil
+}
+
+// RemoveDeviceNode removes the device node from container,
+// and releases the transfer path if it's bind mounted.
+// The node is not removed if the device is mounted in container, unless opts says to unmount
+// or force it, nil opts is used to roll back the node just created.
+func RemoveDeviceNode(driver nsexec.NsDriver, pid, id string, device *types.Device, opts *types.RemoveDeviceOptions) error {
+	var umount string
+	var mountPoints []string
+	if opts != nil && !opts.Force {
+		mounts, err := findContainerMounts(pid, device)
+		if err != nil {
+			return err
+		}
+		if len(mounts) > 0 && opts.Umount == "" {
+			return fmt.Errorf("device %s is mounted in container on %s, use --umount to unmount it or --force to remove it anyway",
+				device.Path, strings.Join(mounts, ", "))
+		}
+		umount, mountPoints = opts.Umount, mounts
+	}
+	if err := driver.RemoveDevice(pid, device, umount, mountPoints); err != nil {
+		return err
+	}
+	if device.BindNode {
+		return utils.RemoveTransferPath(id, nodeBind(device))
+	}
+	return nil
+}
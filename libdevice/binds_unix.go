@@ -24,6 +24,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/opencontainers/runtime-spec/specs-go"
+	"isula.org/syscontainer-tools/pkg/mount"
 	"isula.org/syscontainer-tools/types"
 	"isula.org/syscontainer-tools/utils"
 )
@@ -90,8 +91,11 @@ func ParseBind(bindstr string, spec *specs.Spec, create bool) (*types.Bind, erro
 				if err := os.MkdirAll(src, os.FileMode(0755)); err != nil {
 					return nil, fmt.Errorf("ParseBind mkdir error: %v", err)
 				}
-				if err := os.Chown(src, bind.UID, bind.GID); err != nil {
-					return nil, fmt.Errorf("ParseBind chown error: %v", err)
+				// id-mapped mount keeps the host path owned by root, chown is the fallback.
+				if !utils.HasUserns(spec) || !utils.IDMapSupported() {
+					if err := os.Chown(src, bind.UID, bind.GID); err != nil {
+						return nil, fmt.Errorf("ParseBind chown error: %v", err)
+					}
 				}
 			}
 		} else {
@@ -111,6 +115,31 @@ func ParseBind(bindstr string, spec *specs.Spec, create bool) (*types.Bind, erro
 	return bind, nil
 }
 
+func isReadonlyOption(option string) bool {
+	for _, op := range strings.Split(option, ",") {
+		if op == "ro" || op == mount.RecursiveReadonly {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRemountOption checks if the bind could be remounted from old option to new option,
+// the submounts are bound and made read-only when mounting, they can't be changed by remount.
+// For container with user namespace, the mount propagated to it is locked read-only if it's ro.
+func checkRemountOption(oldOption, newOption string, userns bool) error {
+	if userns && isReadonlyOption(oldOption) && !isReadonlyOption(newOption) {
+		return fmt.Errorf("read-only can't be changed to read-write for container with user namespace, the mount is locked, remove and add the path again")
+	}
+	if mount.IsRecursiveBind(oldOption) != mount.IsRecursiveBind(newOption) {
+		return fmt.Errorf("rbind can't be changed from %s to %s, remove and add the path again", oldOption, newOption)
+	}
+	if mount.IsRecursiveReadonly(oldOption) && !mount.IsRecursiveReadonly(newOption) {
+		return fmt.Errorf("rro can't be changed from %s to %s, remove and add the path again", oldOption, newOption)
+	}
+	return nil
+}
+
 func findPathDevice(path string) (*types.Device, string, error) {
 
 	// find path mount entry point.
@@ -172,25 +201,35 @@ func findDeviceMountEntryPoint(device, mp string) (string, string, string, error
 	return "", "", "", fmt.Errorf("Device Not Found")
 }
 
+// mountOptionGroups are the valid mount options for user input, the ones in a group are exclusive.
+// bind is always added, rbind binds the submounts of host path too.
+var mountOptionGroups = [][]string{
+	{"ro", "rw", mount.RecursiveReadonly},
+	{"rbind"},
+	{"private", "rprivate", "slave", "rslave", "shared", "rshared"},
+	{"nosuid", "suid"},
+	{"nodev", "dev"},
+	{"noexec", "exec"},
+	{"atime", "noatime", "relatime", "strictatime"},
+	{"diratime", "nodiratime"},
+}
+
 // validMountOption will validate the mount option for user input
 func validMountOption(option string) bool {
-	validOp := map[string]bool{
-		"ro": true,
-		"rw": true,
-		// "shared": true,
-		"private": true,
-		// "slave": true,
-		// "rshared": true,
-		"rprivate": true,
-		"rslave":   true,
-	}
-
-	arr := strings.Split(option, ",")
-	for _, op := range arr {
-		if !validOp[op] {
+	group := make(map[string]int)
+	for i, ops := range mountOptionGroups {
+		for _, op := range ops {
+			group[op] = i
+		}
+	}
+
+	used := make(map[int]bool)
+	for _, op := range strings.Split(option, ",") {
+		i, ok := group[op]
+		if !ok || used[i] {
 			return false
 		}
-		validOp[op] = false
+		used[i] = true
 	}
 	return true
 }
@@ -0,0 +1,48 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: bind mount option tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"testing"
+)
+
+func TestValidMountOption(t *testing.T) {
+	tests := []struct {
+		option string
+		valid  bool
+	}{
+		{"ro", true},
+		{"rw,rslave", true},
+		{"rro,rbind,rprivate", true},
+		{"ro,nosuid,nodev,noexec,noatime,nodiratime", true},
+		{"rw,suid,dev,exec,strictatime,diratime", true},
+		// the options in a group are exclusive.
+		{"ro,rw", false},
+		{"ro,rro", false},
+		{"rslave,shared", false},
+		{"nosuid,suid", false},
+		{"noatime,relatime", false},
+		{"rbind,rbind", false},
+		{"ro,ro", false},
+		{"bind", false},
+		{"ro,", false},
+		{"", false},
+		{"rw,unknown", false},
+	}
+	for _, tt := range tests {
+		if got := validMountOption(tt.option); got != tt.valid {
+			t.Errorf("validMountOption(%q) = %v, want %v", tt.option, got, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: add devices described by CDI specs
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/pkg/cdi"
+	"isula.org/syscontainer-tools/types"
+)
+
+// CDIDevices returns the device nodes and mounts of the CDI device to add to container.
+// Env and hooks could not be applied to a running container, they are ignored.
+func CDIDevices(name string, spec *specs.Spec) ([]*types.Device, []*types.Bind, error) {
+	edits, err := cdi.Resolve(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(edits.Env) > 0 || len(edits.Hooks) > 0 {
+		logrus.Warnf("env and hooks of CDI device %s are not supported, ignore them", name)
+		fmt.Fprintf(os.Stdout, "Warning: env and hooks of CDI device %s are ignored.\n", name)
+	}
+
+	var devices []*types.Device
+	for _, node := range edits.DeviceNodes {
+		device, err := CDIDeviceNode(name, node)
+		if err != nil {
+			return nil, nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	// the device is removed by its nodes, mounts alone could not be removed by remove-device.
+	if len(devices) == 0 {
+		return nil, nil, fmt.Errorf("CDI device %s has no device node", name)
+	}
+
+	var binds []*types.Bind
+	for _, m := range edits.Mounts {
+		bind, err := cdiBind(m, spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CDI device %s: %v", name, err)
+		}
+		binds = append(binds, bind)
+	}
+	return devices, binds, nil
+}
+
+// CDIDeviceNode returns the host device of the device node in CDI spec.
+func CDIDeviceNode(name string, node *cdi.DeviceNode) (*types.Device, error) {
+	hostPath := node.HostPath
+	if hostPath == "" {
+		hostPath = node.Path
+	}
+	permissions := node.Permissions
+	if permissions == "" {
+		permissions = "rwm"
+	}
+	if !CheckDeviceMode(permissions) {
+		return nil, fmt.Errorf("CDI device %s: invalid permissions %s of %s", name, permissions, node.Path)
+	}
+	device, err := DeviceFromPath(hostPath, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("CDI device %s: %s: %v", name, hostPath, err)
+	}
+	if (node.Type != "" && node.Type != device.Type) ||
+		(node.Major != 0 && (node.Major != device.Major || node.Minor != device.Minor)) {
+		return nil, fmt.Errorf("CDI device %s: %s is not the device %s %d:%d in spec", name, hostPath, node.Type, node.Major, node.Minor)
+	}
+	device.Path = node.Path
+	if node.UID != nil || node.GID != nil || node.FileMode != nil {
+		device.NodeAttr = &types.NodeAttr{UID: node.UID, GID: node.GID, Mode: node.FileMode}
+	}
+	device.CDIDevice = name
+	return device, nil
+}
+
+// cdiBind converts the bind mount in CDI spec to add-path bind, only ro/rw option is kept.
+func cdiBind(m *cdi.Mount, spec *specs.Spec) (*types.Bind, error) {
+	if m.Type != "" && m.Type != "bind" && m.Type != "none" {
+		return nil, fmt.Errorf("mount type %s of %s is not supported, only bind mount is supported", m.Type, m.ContainerPath)
+	}
+	option := "rw,rslave"
+	for _, opt := range m.Options {
+		switch opt {
+		case "ro":
+			option = "ro,rslave"
+		case "rw", "bind", "rbind":
+		default:
+			logrus.Warnf("mount option %s of %s in CDI spec is ignored", opt, m.ContainerPath)
+		}
+	}
+	if _, err := os.Stat(m.HostPath); err != nil {
+		return nil, err
+	}
+	return ParseBind(fmt.Sprintf("%s:%s:%s", m.HostPath, m.ContainerPath, option), spec, true)
+}
+
+// AddCDIPaths adds the mounts of CDI device to container and records them with the device,
+// they are removed by remove-device along with the last node of the device.
+func AddCDIPaths(c *container.Container, name string, binds []*types.Bind) error {
+	var added []*types.Bind
+	rollback := func() {
+		if len(added) == 0 {
+			return
+		}
+		if err := RemovePath(c, added); err != nil {
+			logrus.Errorf("Failed to remove mounts of CDI device %s: %v", name, err)
+		}
+	}
+	for _, bind := range binds {
+		if err := AddPath(c, []*types.Bind{bind}, ""); err != nil {
+			rollback()
+			return err
+		}
+		added = append(added, bind)
+	}
+	if err := recordCDIMounts(c, name, binds); err != nil {
+		rollback()
+		return fmt.Errorf("failed to record mounts of CDI device %s: %v", name, err)
+	}
+	return nil
+}
+
+func recordCDIMounts(c *container.Container, name string, binds []*types.Bind) error {
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return err
+	}
+	m := &hconfig.CDIMounts{Device: name}
+	for _, bind := range binds {
+		m.Binds = append(m.Binds, bind.ToString())
+	}
+	if err := config.UpdateCDIMounts(m, true); err != nil {
+		return err
+	}
+	return config.Flush()
+}
+
+// removeCDIMounts removes the mounts of CDI devices which have no node left in container,
+// the caller should hold the container lock.
+func removeCDIMounts(c *container.Container, config hconfig.ContainerConfig, devices []*types.Device) []error {
+	var retErr []error
+	for _, device := range devices {
+		if device.CDIDevice == "" {
+			continue
+		}
+		m := config.FindCDIMounts(device.CDIDevice)
+		if m == nil || cdiDeviceInUse(config, device.CDIDevice) {
+			continue
+		}
+		var binds []*types.Bind
+		for _, bindstr := range m.Binds {
+			bind, err := ParseBind(bindstr, c.GetSpec(), false)
+			if err != nil {
+				retErr = append(retErr, fmt.Errorf("CDI device %s: %v", device.CDIDevice, err))
+				continue
+			}
+			// the bind not found in config is removed by remove-path already.
+			if mp, err := config.GetBindInConfig(bind); err != nil || mp == nil {
+				continue
+			}
+			binds = append(binds, bind)
+		}
+		// the record is kept if any of the mounts is left, so they are still known as CDI mounts.
+		if errs := removePaths(c, config, binds); len(errs) != 0 {
+			retErr = append(retErr, errs...)
+			continue
+		}
+		if err := config.UpdateCDIMounts(m, false); err != nil {
+			retErr = append(retErr, err)
+		}
+	}
+	return retErr
+}
+
+func cdiDeviceInUse(config hconfig.ContainerConfig, name string) bool {
+	for _, dm := range config.GetAllDevices() {
+		if dm.CDIDevice == name {
+			return true
+		}
+	}
+	return false
+}
@@ -93,6 +93,8 @@ func WorkInContainer() {
 		err = doAddBind(pipe)
 	case nsexec.RemoveBindMsg:
 		err = doRemoveBind(pipe)
+	case nsexec.RemountBindMsg:
+		err = doRemountBind(pipe)
 	case nsexec.AddTransferBaseMsg:
 		err = doAddTransferBase(pipe)
 	case nsexec.UpdateSysctlMsg:
@@ -174,9 +176,16 @@ func doMount(pipe *os.File) error {
 		}
 		return nil
 	}
+	if err := os.MkdirAll(mnt.Destination, 0755); err != nil {
+		return fmt.Errorf("doMount: create mount destination in container failed, err: %s", err)
+	}
 	return mount.Mount(mnt.Source, mnt.Destination, mnt.Type, mnt.Options)
 }
 
+// errMknodNotPermitted is the error message of add device worker if mknod is not permitted,
+// only in this case the device node could be bind mounted from host instead.
+const errMknodNotPermitted = "Current OS kernel do not support mknod in container user namespace for root"
+
 func doAddDevice(pipe *os.File) error {
 	msg := types.AddDeviceMsg{}
 	if err := json.NewDecoder(pipe).Decode(&msg); err != nil {
@@ -196,6 +205,7 @@ func doAddDevice(pipe *os.File) error {
 		if err := os.Chown(device.Path, int(device.UID), int(device.GID)); err != nil {
 			logrus.Errorf("os.Chown error: %v", err)
 		}
+		createDiskLinks(device)
 		return nil
 	}
 
@@ -235,22 +245,49 @@ func doAddDevice(pipe *os.File) error {
 	}
 
 	if err := MknodDevice(device.Path, device); err != nil {
-		return fmt.Errorf("Current OS kernel do not support mknod in container user namespace for root, err: %s", err)
+		if err == syscall.EPERM {
+			return fmt.Errorf("%s, err: %s", errMknodNotPermitted, err)
+		}
+		return fmt.Errorf("failed to mknod device %s in container: %v", device.Path, err)
 	}
+	createDiskLinks(device)
 	return nil
 }
 
 func doRemoveDevice(pipe *os.File) error {
-	var device types.Device
-	if err := json.NewDecoder(pipe).Decode(&device); err != nil {
+	msg := types.RemoveDeviceMsg{}
+	if err := json.NewDecoder(pipe).Decode(&msg); err != nil {
 		return err
 	}
+	device := msg.Device
+
+	for _, mountPoint := range msg.MountPoints {
+		flags := 0
+		if msg.Umount == types.UmountLazy {
+			flags = syscall.MNT_DETACH
+		}
+		if err := syscall.Unmount(mountPoint, flags); err != nil {
+			return fmt.Errorf("failed to unmount %s: %v", mountPoint, err)
+		}
+		fmt.Printf("unmount %s in container done.\n", mountPoint)
+	}
+
+	if device.DiskLinks {
+		removeDiskLinks(device)
+	}
 
 	// As add-device supports `update-config-only` flag, it will update the config only.
 	// So the device we wantted to remove maybe not exist in container at all, that's fine, just return OK.
 	if _, err := os.Stat(device.Path); os.IsNotExist(err) {
 		return nil
 	}
+	// bind mounted node, the mountpoint is a regular file created by doAddBind.
+	if device.BindNode {
+		if err := mount.Unmount(device.Path); err != nil {
+			return err
+		}
+		return os.Remove(device.Path)
+	}
 	// if not a device.
 	if _, err := DeviceFromPath(device.Path, ""); err != nil {
 		return err
@@ -316,6 +353,18 @@ func doRemoveBind(pipe *os.File) error {
 	return mount.Unmount(bind.ContainerPath)
 }
 
+func doRemountBind(pipe *os.File) error {
+	var bind types.Bind
+	if err := json.NewDecoder(pipe).Decode(&bind); err != nil {
+		return err
+	}
+
+	if err := mount.RemountBind(bind.ContainerPath, bind.MountOption); err != nil {
+		return fmt.Errorf("fail to remount %s with %s, err: %s", bind.ContainerPath, bind.MountOption, err)
+	}
+	return nil
+}
+
 func doAddTransferBase(pipe *os.File) error {
 	var bind types.Bind
 	if err := json.NewDecoder(pipe).Decode(&bind); err != nil {
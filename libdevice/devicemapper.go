@@ -0,0 +1,219 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: device-mapper(LVM, multipath) device operation
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"isula.org/syscontainer-tools/types"
+)
+
+const (
+	sysBlockDir = "/sys/block"
+	// kpartx creates partitions of multipath device with uuid "part<N>-<uuid of disk>"
+	dmPartUUIDPrefix = "part"
+	// maxDeviceStackDepth is the limit to walk through the device stack
+	maxDeviceStackDepth = 16
+)
+
+// DmInfo is the device-mapper information of a block device
+type DmInfo struct {
+	Name    string   // dm name, also the name in /dev/mapper
+	UUID    string   // dm uuid, like "LVM-xxx", "mpath-xxx"
+	Slaves  []string // kernel names of the underlying devices
+	Holders []string // kernel names of the devices stacked on it
+}
+
+// sysfsBlockPath returns the sysfs dir of block device
+func sysfsBlockPath(major, minor int64) string {
+	return fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)
+}
+
+func readSysfsValue(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func listSysfsDir(path string) []string {
+	var names []string
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return names
+	}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+// IsDmDevice returns if the block device is a device-mapper device
+func IsDmDevice(device *types.Device) bool {
+	if device.Type != "b" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(sysfsBlockPath(device.Major, device.Minor), "dm"))
+	return err == nil
+}
+
+// GetDmInfo returns the device-mapper information of the device
+func GetDmInfo(device *types.Device) (*DmInfo, error) {
+	if !IsDmDevice(device) {
+		return nil, fmt.Errorf("%s is not a device-mapper device", device.PathOnHost)
+	}
+	base := sysfsBlockPath(device.Major, device.Minor)
+	return &DmInfo{
+		Name:    readSysfsValue(filepath.Join(base, "dm", "name")),
+		UUID:    readSysfsValue(filepath.Join(base, "dm", "uuid")),
+		Slaves:  listSysfsDir(filepath.Join(base, "slaves")),
+		Holders: listSysfsDir(filepath.Join(base, "holders")),
+	}, nil
+}
+
+// kernelNameToPath returns the preferred device path on host of kernel device name,
+// /dev/mapper/<name> for device-mapper devices, /dev/<name> for others.
+func kernelNameToPath(name string) string {
+	if dmName := readSysfsValue(filepath.Join(sysBlockDir, name, "dm", "name")); dmName != "" {
+		return filepath.Join("/dev/mapper", dmName)
+	}
+	return filepath.Join("/dev", name)
+}
+
+func devicesFromKernelNames(names []string, parent *types.Device) []*types.Device {
+	var devices []*types.Device
+	for _, name := range names {
+		dev, err := DeviceFromPath(kernelNameToPath(name), parent.Permissions)
+		if err != nil {
+			continue
+		}
+		SetDefaultPath(dev)
+		dev.Parent = parent.PathOnHost
+		dev.NodeAttr = parent.NodeAttr
+		devices = append(devices, dev)
+	}
+	return devices
+}
+
+// FindDmSlaves returns the devices directly under the device-mapper device.
+// eg: PVs of a LVM LV, paths of a multipath device.
+func FindDmSlaves(device *types.Device) []*types.Device {
+	info, err := GetDmInfo(device)
+	if err != nil {
+		return nil
+	}
+	return devicesFromKernelNames(info.Slaves, device)
+}
+
+// FindDmHolders returns the device-mapper devices directly stacked on the device.
+func FindDmHolders(device *types.Device) []*types.Device {
+	if device.Type != "b" {
+		return nil
+	}
+	names := listSysfsDir(filepath.Join(sysfsBlockPath(device.Major, device.Minor), "holders"))
+	return devicesFromKernelNames(names, device)
+}
+
+// FindDmPartitions returns the partitions created by kpartx for the device-mapper device.
+func FindDmPartitions(device *types.Device) []*types.Device {
+	var parts []*types.Device
+	for _, holder := range FindDmHolders(device) {
+		info, err := GetDmInfo(holder)
+		if err != nil || !strings.HasPrefix(info.UUID, dmPartUUIDPrefix) {
+			continue
+		}
+		if device.Path != "" && device.Path != device.PathOnHost {
+			// keep the partition suffix, eg: /dev/mapper/mpatha1 ==> <container path>1
+			holder.Path = device.Path + strings.TrimPrefix(filepath.Base(holder.PathOnHost), filepath.Base(device.PathOnHost))
+		}
+		parts = append(parts, holder)
+	}
+	return parts
+}
+
+// GetDmParent returns the disk(pathonhost) of a kpartx partition, or empty string for others.
+func GetDmParent(device *types.Device) string {
+	info, err := GetDmInfo(device)
+	if err != nil || !strings.HasPrefix(info.UUID, dmPartUUIDPrefix) || len(info.Slaves) != 1 {
+		return ""
+	}
+	return kernelNameToPath(info.Slaves[0])
+}
+
+// FindPhysicalDevices returns the whole disks at the bottom of the device stack,
+// blkio throttle and weight of stacked devices should be applied to them.
+func FindPhysicalDevices(device *types.Device) ([]*types.Device, error) {
+	var physical []*types.Device
+	seen := make(map[string]bool)
+
+	var walk func(major, minor int64, depth int) error
+	walk = func(major, minor int64, depth int) error {
+		if depth > maxDeviceStackDepth {
+			return fmt.Errorf("device stack of %s is too deep", device.PathOnHost)
+		}
+		base := sysfsBlockPath(major, minor)
+		slaves := listSysfsDir(filepath.Join(base, "slaves"))
+		if len(slaves) == 0 {
+			// partition is not supported by blkio cgroup, use the disk it belongs to.
+			name := filepath.Base(GetDeviceRealPath(base))
+			if _, err := os.Stat(filepath.Join(base, "partition")); err == nil {
+				name = filepath.Base(filepath.Dir(GetDeviceRealPath(base)))
+			}
+			if seen[name] {
+				return nil
+			}
+			seen[name] = true
+			dev, err := DeviceFromPath(filepath.Join("/dev", name), "")
+			if err != nil {
+				return err
+			}
+			physical = append(physical, dev)
+			return nil
+		}
+		for _, slave := range slaves {
+			dev, err := DeviceFromPath(filepath.Join("/dev", slave), "")
+			if err != nil {
+				return err
+			}
+			if err := walk(dev.Major, dev.Minor, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(device.Major, device.Minor, 0); err != nil {
+		return nil, err
+	}
+	return physical, nil
+}
+
+// FindDmDeviceByUUID returns the current device node of the device-mapper device with uuid.
+// The dm-N name and minor number may change after reboot, but the uuid will not.
+func FindDmDeviceByUUID(uuid string) (string, error) {
+	for _, name := range listSysfsDir(sysBlockDir) {
+		if !strings.HasPrefix(name, "dm-") {
+			continue
+		}
+		if readSysfsValue(filepath.Join(sysBlockDir, name, "dm", "uuid")) == uuid {
+			return filepath.Join("/dev", name), nil
+		}
+	}
+	return "", fmt.Errorf("device-mapper device with uuid %s not found", uuid)
+}
@@ -0,0 +1,258 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: cgroup-only device rule operation
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/pkg/policy"
+	"isula.org/syscontainer-tools/types"
+)
+
+const wildcardNumber = policy.WildcardNumber
+
+func parseDeviceNumber(number string) (int64, error) {
+	if number == "*" {
+		return wildcardNumber, nil
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err == nil && n < 0 {
+		return 0, fmt.Errorf("negative device number %d", n)
+	}
+	return n, err
+}
+
+// ParseDeviceRule parses the cgroup device rule, eg: "c 136:* rwm"
+func ParseDeviceRule(rule string) (*types.Device, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid device rule: %q, should be like \"c 136:* rwm\"", rule)
+	}
+	if fields[0] != "c" && fields[0] != "b" {
+		return nil, fmt.Errorf("invalid device type %q of rule: %q, only c and b are supported", fields[0], rule)
+	}
+	numbers := strings.Split(fields[1], ":")
+	if len(numbers) != 2 {
+		return nil, fmt.Errorf("invalid device number %q of rule: %q", fields[1], rule)
+	}
+	major, err := parseDeviceNumber(numbers[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid major number %q of rule: %q", numbers[0], rule)
+	}
+	minor, err := parseDeviceNumber(numbers[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid minor number %q of rule: %q", numbers[1], rule)
+	}
+	if !CheckDeviceMode(fields[2]) {
+		return nil, fmt.Errorf("invalid permission %q of rule: %q", fields[2], rule)
+	}
+	return &types.Device{
+		Type:        fields[0],
+		Major:       major,
+		Minor:       minor,
+		Permissions: fields[2],
+	}, nil
+}
+
+// AddDeviceRule adds cgroup device rules to container without creating nodes.
+func AddDeviceRule(c *container.Container, rules []*types.Device) error {
+	return updateDeviceRules(c, rules, true)
+}
+
+// RemoveDeviceRule removes cgroup device rules added by AddDeviceRule from container.
+func RemoveDeviceRule(c *container.Container, rules []*types.Device) error {
+	return updateDeviceRules(c, rules, false)
+}
+
+func updateDeviceRules(c *container.Container, rules []*types.Device, isAdd bool) error {
+	pid := strconv.Itoa(c.Pid())
+
+	// a rule grants access to the devices in its range, it's denied if any of them is denied.
+	if isAdd {
+		if err := checkDevicePolicy(c, policy.OpAddDevice, rules); err != nil {
+			return err
+		}
+	}
+
+	innerPath, err := c.GetCgroupPath()
+	if err != nil {
+		return err
+	}
+
+	cgroupPath, err := FindCgroupPath(pid, "devices", innerPath)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return err
+	}
+	defer config.Flush()
+
+	action := "Remove"
+	if isAdd {
+		action = "Add"
+	}
+
+	var retErr []error
+	for _, rule := range rules {
+		if !isAdd {
+			// permissions of the rule to remove is not required, use the saved one.
+			rule.Permissions = "rwm"
+		}
+		if err := config.UpdateDeviceRule(rule, isAdd); err != nil {
+			retErr = append(retErr, err)
+			continue
+		}
+
+		if c.Pid() > 0 && c.CheckPidExist() {
+			if err := UpdateCgroupPermission(cgroupPath, rule, isAdd); err != nil {
+				retErr = append(retErr, err)
+				config.UpdateDeviceRule(rule, !isAdd)
+				continue
+			}
+			if !isAdd {
+				restoreDevicesPermission(c.GetSpec(), config, cgroupPath, rule)
+			}
+		}
+
+		fmt.Fprintf(os.Stdout, "%s device rule (%s) for container(%s) done.\n", action, rule.CgroupString(), c.Name())
+		logrus.Infof("%s device rule (%s) for container(%s) done", action, rule.CgroupString(), c.Name())
+	}
+
+	if len(retErr) == 0 {
+		return nil
+	}
+	for i := 0; i < len(retErr); i++ {
+		retErr[i] = fmt.Errorf("%s", retErr[i].Error())
+	}
+	return errors.New(strings.Trim(fmt.Sprint(retErr), "[]"))
+}
+
+// rulesOverlap checks if the two rules have any device in common, wildcard matches any number.
+func rulesOverlap(a, b *types.Device) bool {
+	numberOverlap := func(x, y int64) bool {
+		return x == wildcardNumber || y == wildcardNumber || x == y
+	}
+	return (a.Type == b.Type || a.Type == "a" || b.Type == "a") &&
+		numberOverlap(a.Major, b.Major) && numberOverlap(a.Minor, b.Minor)
+}
+
+// specDeviceRules returns the rules allowed by spec in the range of rule,
+// the ones denied again by the later entries of spec are skipped.
+func specDeviceRules(spec *specs.Spec, rule *types.Device) []*types.Device {
+	if spec == nil || spec.Linux == nil || spec.Linux.Resources == nil {
+		return nil
+	}
+	var entries []*types.Device
+	var allows []bool
+	for _, d := range spec.Linux.Resources.Devices {
+		entry := &types.Device{
+			Type:        d.Type,
+			Major:       wildcardNumber,
+			Minor:       wildcardNumber,
+			Permissions: d.Access,
+		}
+		if entry.Type == "" {
+			entry.Type = "a"
+		}
+		if d.Major != nil {
+			entry.Major = *d.Major
+		}
+		if d.Minor != nil {
+			entry.Minor = *d.Minor
+		}
+		entries = append(entries, entry)
+		allows = append(allows, d.Allow)
+	}
+
+	var rules []*types.Device
+	for i, entry := range entries {
+		if !allows[i] || !rulesOverlap(rule, entry) {
+			continue
+		}
+		denied := false
+		for j := i + 1; j < len(entries); j++ {
+			if !allows[j] && rulesOverlap(entry, entries[j]) {
+				denied = true
+				break
+			}
+		}
+		if !denied {
+			rules = append(rules, entry)
+		}
+	}
+	return rules
+}
+
+// restoreDevicesPermission allows the devices granted by spec, the added devices and the left rules
+// in the range of the removed rule again, deny of the rule removes their permissions too.
+func restoreDevicesPermission(spec *specs.Spec, config hconfig.ContainerConfig, cgroupPath string, rule *types.Device) {
+	for _, granted := range specDeviceRules(spec, rule) {
+		if err := UpdateCgroupPermission(cgroupPath, granted, true); err != nil {
+			logrus.Errorf("Failed to restore permission of device rule %s in spec: %v", granted.CgroupString(), err)
+		}
+	}
+	for _, dm := range config.GetAllDevices() {
+		device := &types.Device{
+			Type:        dm.Type,
+			Major:       dm.Major,
+			Minor:       dm.Minor,
+			Permissions: dm.CgroupPermissions,
+		}
+		if !rulesOverlap(rule, device) {
+			continue
+		}
+		if err := UpdateCgroupPermission(cgroupPath, device, true); err != nil {
+			logrus.Errorf("Failed to restore permission of device %s: %v", dm.PathOnHost, err)
+		}
+	}
+	for _, ruleStr := range config.GetDeviceRules() {
+		left, err := ParseDeviceRule(ruleStr)
+		if err != nil || !rulesOverlap(rule, left) {
+			continue
+		}
+		if err := UpdateCgroupPermission(cgroupPath, left, true); err != nil {
+			logrus.Errorf("Failed to restore permission of device rule %s: %v", ruleStr, err)
+		}
+	}
+}
+
+// ListDeviceRule list cgroup-only device rules of container
+func ListDeviceRule(c *container.Container) ([]string, error) {
+	if err := c.Lock(); err != nil {
+		return nil, err
+	}
+	defer c.Unlock()
+	hConfig, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return hConfig.GetDeviceRules(), nil
+}
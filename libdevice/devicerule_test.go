@@ -0,0 +1,119 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: cgroup-only device rule tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseDeviceRule(t *testing.T) {
+	tests := []struct {
+		rule  string
+		valid bool
+		want  string
+	}{
+		{"c 136:* rwm", true, "c 136:* rwm"},
+		{"b 8:0 r", true, "b 8:0 r"},
+		{"c *:* m", true, "c *:* m"},
+		{"a 1:3 rwm", false, ""},
+		{"c 136 rwm", false, ""},
+		{"c -1:3 rwm", false, ""},
+		{"c 1:x rwm", false, ""},
+		{"c 1:3 rwx", false, ""},
+		{"c 1:3", false, ""},
+	}
+	for _, tt := range tests {
+		rule, err := ParseDeviceRule(tt.rule)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseDeviceRule(%q) error = %v, want valid %v", tt.rule, err, tt.valid)
+			continue
+		}
+		if err == nil && rule.CgroupString() != tt.want {
+			t.Errorf("ParseDeviceRule(%q) = %q, want %q", tt.rule, rule.CgroupString(), tt.want)
+		}
+	}
+}
+
+func TestRulesOverlap(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"c 136:* rwm", "c 136:5 rwm", true},
+		{"c 136:5 rwm", "c 136:* rwm", true},
+		{"c 136:5 rwm", "c 136:6 rwm", false},
+		{"c *:5 rwm", "c 136:* rwm", true},
+		{"c 136:* rwm", "b 136:* rwm", false},
+	}
+	for _, tt := range tests {
+		a, _ := ParseDeviceRule(tt.a)
+		b, _ := ParseDeviceRule(tt.b)
+		if got := rulesOverlap(a, b); got != tt.overlap {
+			t.Errorf("rulesOverlap(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.overlap)
+		}
+	}
+}
+
+func TestSpecDeviceRules(t *testing.T) {
+	number := func(n int64) *int64 {
+		return &n
+	}
+	spec := &specs.Spec{
+		Linux: &specs.Linux{
+			Resources: &specs.LinuxResources{
+				Devices: []specs.LinuxDeviceCgroup{
+					{Allow: false, Access: "rwm"},
+					{Allow: true, Type: "c", Major: number(136), Access: "rwm"},
+					{Allow: true, Type: "c", Major: number(1), Minor: number(3), Access: "rwm"},
+					{Allow: true, Type: "c", Major: number(10), Minor: number(200), Access: "rwm"},
+					{Allow: false, Type: "c", Major: number(10), Minor: number(200), Access: "rwm"},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		rule string
+		want []string
+	}{
+		// the rule duplicates the default of spec.
+		{"c 136:* rwm", []string{"c 136:* rwm"}},
+		{"c 136:2 rwm", []string{"c 136:* rwm"}},
+		{"c *:* rwm", []string{"c 136:* rwm", "c 1:3 rwm"}},
+		// the allowed entry is denied again by spec.
+		{"c 10:200 rwm", nil},
+		{"b 8:0 rwm", nil},
+	}
+	for _, tt := range tests {
+		rule, err := ParseDeviceRule(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, granted := range specDeviceRules(spec, rule) {
+			got = append(got, granted.CgroupString())
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("specDeviceRules(%q) = %v, want %v", tt.rule, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("specDeviceRules(%q) = %v, want %v", tt.rule, got, tt.want)
+				break
+			}
+		}
+	}
+}
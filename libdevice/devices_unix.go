@@ -21,6 +21,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -42,9 +43,20 @@ var (
 // ParseMapping will return a device with mapping segment only.
 func ParseMapping(device string) (*types.Device, error) {
 	var src, dst, permissions string
+	var nodeAttr *types.NodeAttr
 	arr := strings.Split(device, ":")
 	permissions = "rwm"
 
+	// node attributes are always the last segment, eg: /dev/ttyUSB0:/dev/ttyUSB0:rw:uid=0,gid=20,mode=0660
+	if len(arr) > 1 && strings.Contains(arr[len(arr)-1], "=") {
+		attr, err := ParseNodeAttr(arr[len(arr)-1])
+		if err != nil {
+			return nil, err
+		}
+		nodeAttr = attr
+		arr = arr[:len(arr)-1]
+	}
+
 	// According to the length of device specifications
 	if len(arr) < 1 || len(arr) > 3 {
 		return nil, fmt.Errorf("invalid device specification: %s", device)
@@ -87,11 +99,46 @@ func ParseMapping(device string) (*types.Device, error) {
 		Path:        dst,
 		PathOnHost:  src,
 		Permissions: permissions,
+		NodeAttr:    nodeAttr,
 	}
 
 	return ret, nil
 }
 
+// ParseNodeAttr parses the owner and mode options of device node, eg: uid=0,gid=20,mode=0660
+func ParseNodeAttr(opts string) (*types.NodeAttr, error) {
+	attr := &types.NodeAttr{}
+	for _, opt := range strings.Split(opts, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid device node option: %s", opt)
+		}
+		switch kv[0] {
+		case "uid", "gid":
+			id, err := strconv.ParseUint(kv[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", kv[0], kv[1])
+			}
+			val := uint32(id)
+			if kv[0] == "uid" {
+				attr.UID = &val
+			} else {
+				attr.GID = &val
+			}
+		case "mode":
+			mode, err := strconv.ParseUint(kv[1], 8, 32)
+			if err != nil || mode > uint64(os.ModePerm) {
+				return nil, fmt.Errorf("invalid mode: %s", kv[1])
+			}
+			val := uint32(mode)
+			attr.Mode = &val
+		default:
+			return nil, fmt.Errorf("unknown device node option: %s", kv[0])
+		}
+	}
+	return attr, nil
+}
+
 // CheckDeviceMode checks if the mode is ilegal.
 func CheckDeviceMode(mode string) bool {
 	var DeviceMode = map[rune]bool{
@@ -124,6 +171,7 @@ func ParseDevice(device string) (*types.Device, error) {
 		return nil, err
 	}
 	dev.Path = mapDevice.Path
+	dev.NodeAttr = mapDevice.NodeAttr
 	return dev, nil
 }
 
@@ -221,6 +269,7 @@ func FindSubPartition(device *types.Device) []*types.Device {
 			continue
 		}
 		dev.Parent = device.PathOnHost
+		dev.NodeAttr = device.NodeAttr
 		subDevices = append(subDevices, dev)
 	}
 	return subDevices
@@ -0,0 +1,96 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: /dev/disk/by-* links of disks
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"isula.org/syscontainer-tools/types"
+)
+
+var (
+	hostDevDir   = "/dev"
+	diskLinkDirs = []string{"by-id", "by-uuid", "by-label", "by-path"}
+)
+
+// FindDiskLinks returns the paths of /dev/disk/by-* links of the device under devRoot,
+// the links are found on host, which are maintained by udevd.
+func FindDiskLinks(device *types.Device, devRoot string) []string {
+	var links []string
+	if device.Type != "b" {
+		return links
+	}
+	for _, dir := range diskLinkDirs {
+		linkDir := filepath.Join(hostDevDir, "disk", dir)
+		for _, name := range listSysfsDir(linkDir) {
+			dev, err := DeviceFromPath(filepath.Join(linkDir, name), "")
+			if err != nil || dev.Type != device.Type || dev.Major != device.Major || dev.Minor != device.Minor {
+				continue
+			}
+			links = append(links, filepath.Join(devRoot, "disk", dir, name))
+		}
+	}
+	return links
+}
+
+// createDiskLinks creates the links to the device node, it's called in container.
+func createDiskLinks(device *types.Device) {
+	for _, link := range device.LinkPaths {
+		// relative target, like the ones created by udevd, works both before and after pivot_root.
+		target, err := filepath.Rel(filepath.Dir(link), device.Path)
+		if err != nil {
+			logrus.Errorf("failed to get link target of %s: %v", link, err)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			logrus.Errorf("failed to create dir for link %s: %v", link, err)
+			continue
+		}
+		if fi, err := os.Lstat(link); err == nil {
+			if fi.Mode()&os.ModeSymlink == 0 {
+				logrus.Errorf("%s exists and is not a link, skip it", link)
+				continue
+			}
+			os.Remove(link)
+		}
+		if err := os.Symlink(target, link); err != nil {
+			logrus.Errorf("failed to create link %s: %v", link, err)
+		}
+	}
+}
+
+// removeDiskLinks removes all the /dev/disk/by-* links to the device node, it's called in container.
+func removeDiskLinks(device *types.Device) {
+	for _, dir := range diskLinkDirs {
+		linkDir := filepath.Join(hostDevDir, "disk", dir)
+		for _, name := range listSysfsDir(linkDir) {
+			link := filepath.Join(linkDir, name)
+			target, err := os.Readlink(link)
+			if err != nil {
+				continue
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(linkDir, target)
+			}
+			if filepath.Clean(target) != filepath.Clean(device.Path) {
+				continue
+			}
+			if err := os.Remove(link); err != nil {
+				logrus.Errorf("failed to remove link %s: %v", link, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: io statistics of devices in container
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+)
+
+const (
+	cgroup2Root = "/sys/fs/cgroup"
+)
+
+// DeviceStats is the io statistics and qos limits of a block device added to container
+type DeviceStats struct {
+	PathOnHost      string `json:"pathOnHost"`
+	PathInContainer string `json:"pathInContainer"`
+	Major           int64  `json:"major"`
+	Minor           int64  `json:"minor"`
+	ReadBytes       uint64 `json:"readBytes"`
+	WriteBytes      uint64 `json:"writeBytes"`
+	ReadIOs         uint64 `json:"readIOs"`
+	WriteIOs        uint64 `json:"writeIOs"`
+	// limits configured by syscontainer-tools, empty if not limited.
+	ReadBpsLimit   string `json:"readBpsLimit,omitempty"`
+	WriteBpsLimit  string `json:"writeBpsLimit,omitempty"`
+	ReadIOPSLimit  string `json:"readIOPSLimit,omitempty"`
+	WriteIOPSLimit string `json:"writeIOPSLimit,omitempty"`
+}
+
+// ioCounters is the io counters of a device in cgroup
+type ioCounters struct {
+	readBytes, writeBytes, readIOs, writeIOs uint64
+}
+
+// isCgroup2 returns if the host uses cgroup v2 unified hierarchy
+func isCgroup2() bool {
+	_, err := os.Stat(filepath.Join(cgroup2Root, "cgroup.controllers"))
+	return err == nil
+}
+
+// findCgroup2Path returns the cgroup v2 dir of container
+func findCgroup2Path(pid, innerPath string) (string, error) {
+	if filepath.IsAbs(innerPath) {
+		return filepath.Join(cgroup2Root, innerPath), nil
+	}
+	f, err := os.Open(filepath.Join("/proc", pid, "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 0::/isulad/<id>
+		if path := strings.TrimPrefix(scanner.Text(), "0::"); path != scanner.Text() {
+			return filepath.Join(cgroup2Root, path), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("cgroup v2 path of process %s is not found", pid)
+}
+
+// parseBlkioStatFile parses blkio.throttle.io_service_bytes and blkio.throttle.io_serviced,
+// the lines are like "8:0 Read 1024".
+func parseBlkioStatFile(path string, counters map[string]*ioCounters, bytes bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		c, ok := counters[fields[0]]
+		if !ok {
+			c = &ioCounters{}
+			counters[fields[0]] = c
+		}
+		switch {
+		case fields[1] == "Read" && bytes:
+			c.readBytes = v
+		case fields[1] == "Write" && bytes:
+			c.writeBytes = v
+		case fields[1] == "Read":
+			c.readIOs = v
+		case fields[1] == "Write":
+			c.writeIOs = v
+		}
+	}
+	return scanner.Err()
+}
+
+// parseIOStatFile parses io.stat of cgroup v2, the lines are like "8:0 rbytes=1024 wbytes=0 rios=1 wios=0 ..."
+func parseIOStatFile(path string, counters map[string]*ioCounters) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		c := &ioCounters{}
+		for _, kv := range fields[1:] {
+			arr := strings.SplitN(kv, "=", 2)
+			if len(arr) != 2 {
+				continue
+			}
+			v, err := strconv.ParseUint(arr[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch arr[0] {
+			case "rbytes":
+				c.readBytes = v
+			case "wbytes":
+				c.writeBytes = v
+			case "rios":
+				c.readIOs = v
+			case "wios":
+				c.writeIOs = v
+			}
+		}
+		counters[fields[0]] = c
+	}
+	return scanner.Err()
+}
+
+// readIOCounters reads the io counters of all devices in container cgroup, keyed by "major:minor"
+func readIOCounters(pid, innerPath string) (map[string]*ioCounters, error) {
+	counters := make(map[string]*ioCounters)
+	if isCgroup2() {
+		cgroupPath, err := findCgroup2Path(pid, innerPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := parseIOStatFile(filepath.Join(cgroupPath, "io.stat"), counters); err != nil {
+			return nil, err
+		}
+		return counters, nil
+	}
+
+	cgroupPath, err := FindCgroupPath(pid, "blkio", innerPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := parseBlkioStatFile(filepath.Join(cgroupPath, "blkio.throttle.io_service_bytes"), counters, true); err != nil {
+		return nil, err
+	}
+	if err := parseBlkioStatFile(filepath.Join(cgroupPath, "blkio.throttle.io_serviced"), counters, false); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+// deviceQosLimit returns the qos value configured for the device, including the one applied to its physical devices.
+func deviceQosLimit(config hconfig.ContainerConfig, qType hconfig.QosType, dm *hconfig.DeviceMapping) string {
+	for _, qos := range config.GetDeviceQos(qType) {
+		if (qos.Major == dm.Major && qos.Minor == dm.Minor && qos.Holder == "") || qos.Holder == dm.PathOnHost {
+			return qos.Value
+		}
+	}
+	return ""
+}
+
+// GetDeviceStats returns the io statistics of block devices added to container.
+func GetDeviceStats(c *container.Container) ([]*DeviceStats, error) {
+	if c.Pid() <= 0 || !c.CheckPidExist() {
+		return nil, fmt.Errorf("container %s is not running", c.Name())
+	}
+	pid := strconv.Itoa(c.Pid())
+	innerPath, err := c.GetCgroupPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Lock(); err != nil {
+		return nil, err
+	}
+	defer c.Unlock()
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	counters, err := readIOCounters(pid, innerPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []*DeviceStats
+	for _, dm := range config.GetAllDevices() {
+		if dm.Type != "b" {
+			continue
+		}
+		s := &DeviceStats{
+			PathOnHost:      dm.PathOnHost,
+			PathInContainer: dm.PathInContainer,
+			Major:           dm.Major,
+			Minor:           dm.Minor,
+			ReadBpsLimit:    deviceQosLimit(config, hconfig.QosReadBps, dm),
+			WriteBpsLimit:   deviceQosLimit(config, hconfig.QosWriteBps, dm),
+			ReadIOPSLimit:   deviceQosLimit(config, hconfig.QosReadIOPS, dm),
+			WriteIOPSLimit:  deviceQosLimit(config, hconfig.QosWriteIOPS, dm),
+		}
+		if counter, ok := counters[devNumString(dm.Major, dm.Minor)]; ok {
+			s.ReadBytes = counter.readBytes
+			s.WriteBytes = counter.writeBytes
+			s.ReadIOs = counter.readIOs
+			s.WriteIOs = counter.writeIOs
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
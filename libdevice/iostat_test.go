@@ -0,0 +1,104 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: io statistics parsing tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseBlkioStatFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iostat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bytesFile := writeTestFile(t, dir, "blkio.throttle.io_service_bytes", `8:0 Read 4096
+8:0 Write 1024
+8:0 Sync 5120
+8:0 Async 0
+8:0 Total 5120
+8:16 Read 512
+8:16 Write bad
+Total 5632
+`)
+	servicedFile := writeTestFile(t, dir, "blkio.throttle.io_serviced", `8:0 Read 4
+8:0 Write 1
+8:0 Total 5
+`)
+
+	counters := make(map[string]*ioCounters)
+	if err := parseBlkioStatFile(bytesFile, counters, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseBlkioStatFile(servicedFile, counters, false); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ioCounters{
+		"8:0":  {readBytes: 4096, writeBytes: 1024, readIOs: 4, writeIOs: 1},
+		"8:16": {readBytes: 512},
+	}
+	if len(counters) != len(want) {
+		t.Fatalf("counters = %v, want %v", counters, want)
+	}
+	for num, w := range want {
+		if c, ok := counters[num]; !ok || *c != w {
+			t.Errorf("counters of %s = %+v, want %+v", num, c, w)
+		}
+	}
+
+	if err := parseBlkioStatFile(filepath.Join(dir, "missing"), counters, true); err == nil {
+		t.Errorf("parseBlkioStatFile should fail for missing file")
+	}
+}
+
+func TestParseIOStatFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iostat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestFile(t, dir, "io.stat", `8:0 rbytes=4096 wbytes=1024 rios=4 wios=1 dbytes=0 dios=0
+253:0 rbytes=512 wbytes=x rios=1
+8:16
+`)
+	counters := make(map[string]*ioCounters)
+	if err := parseIOStatFile(path, counters); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ioCounters{
+		"8:0":   {readBytes: 4096, writeBytes: 1024, readIOs: 4, writeIOs: 1},
+		"253:0": {readBytes: 512, readIOs: 1},
+	}
+	if len(counters) != len(want) {
+		t.Fatalf("counters = %v, want %v", counters, want)
+	}
+	for num, w := range want {
+		if c, ok := counters[num]; !ok || *c != w {
+			t.Errorf("counters of %s = %+v, want %+v", num, c, w)
+		}
+	}
+}
@@ -25,12 +25,21 @@ import (
 	hconfig "isula.org/syscontainer-tools/config"
 	"isula.org/syscontainer-tools/container"
 	"isula.org/syscontainer-tools/libdevice/nsexec"
+	"isula.org/syscontainer-tools/pkg/policy"
 	"isula.org/syscontainer-tools/pkg/udevd"
 	"isula.org/syscontainer-tools/types"
 	"isula.org/syscontainer-tools/utils"
 )
 
 func checkDevice(config hconfig.ContainerConfig, devs []*types.Device, opts *types.AddDeviceOptions) error {
+	if !opts.ForceUnsafe {
+		for _, dev := range devs {
+			if err := checkDeviceSafety(dev, devs); err != nil {
+				return err
+			}
+		}
+	}
+
 	devices := devs
 	// check all devices, config updated
 	if len(devs) == 0 {
@@ -46,8 +55,21 @@ func checkDevice(config hconfig.ContainerConfig, devs []*types.Device, opts *typ
 	}
 
 	checkDeviceQos := func(qos *types.Qos) bool {
+		major, minor := qos.Major, qos.Minor
+		// qos applied to physical devices is checked by the stacked device.
+		if qos.Holder != "" {
+			hMajor, hMinor, err := GetDeviceNum(qos.Holder)
+			if err != nil {
+				return false
+			}
+			major, minor = hMajor, hMinor
+		}
 		for _, device := range devices {
-			if device.Major == qos.Major && device.Minor == qos.Minor {
+			if device.Major == major && device.Minor == minor {
+				if qos.Holder != "" {
+					// keep the same name with device config, qos is removed along with it.
+					qos.Holder = device.PathOnHost
+				}
 				return true
 			}
 		}
@@ -64,10 +86,11 @@ func checkDevice(config hconfig.ContainerConfig, devs []*types.Device, opts *typ
 	return nil
 }
 
-// UpdateDeviceOwner update device owner
-func UpdateDeviceOwner(spec *specs.Spec, device *types.Device) {
+// UpdateDeviceOwner update device owner, it fails if the user specified owner
+// is not mapped in the user namespace of container.
+func UpdateDeviceOwner(spec *specs.Spec, device *types.Device) error {
 	if spec == nil {
-		return
+		return nil
 	}
 
 	uid, gid := utils.GetUIDGid(spec)
@@ -78,6 +101,38 @@ func UpdateDeviceOwner(spec *specs.Spec, device *types.Device) {
 	if gid != -1 {
 		device.GID = uint32(gid)
 	}
+
+	// user specified owner and mode take precedence.
+	attr := device.NodeAttr
+	if attr == nil {
+		return nil
+	}
+	if attr.UID != nil || attr.GID != nil {
+		var cUID, cGID uint32
+		if attr.UID != nil {
+			cUID = *attr.UID
+		}
+		if attr.GID != nil {
+			cGID = *attr.GID
+		}
+		hostUID, hostGID := utils.GetHostUIDGid(spec, cUID, cGID)
+		if attr.UID != nil {
+			if hostUID == -1 {
+				return fmt.Errorf("uid %d of device %s is not mapped in user namespace of container", cUID, device.Path)
+			}
+			device.UID = uint32(hostUID)
+		}
+		if attr.GID != nil {
+			if hostGID == -1 {
+				return fmt.Errorf("gid %d of device %s is not mapped in user namespace of container", cGID, device.Path)
+			}
+			device.GID = uint32(hostGID)
+		}
+	}
+	if attr.Mode != nil {
+		device.FileMode = (device.FileMode &^ os.ModePerm) | os.FileMode(*attr.Mode)
+	}
+	return nil
 }
 
 // AddDevice will add devices to a container.
@@ -95,11 +150,20 @@ func AddDevice(c *container.Container, devices []*types.Device, opts *types.AddD
 		return err
 	}
 
+	if err := checkDevicePolicy(c, policy.OpAddDevice, devices); err != nil {
+		return err
+	}
+
 	for _, device := range devices {
-		UpdateDeviceOwner(c.GetSpec(), device)
+		if err := UpdateDeviceOwner(c.GetSpec(), device); err != nil {
+			return err
+		}
+		if device.DiskLinks {
+			device.LinkPaths = FindDiskLinks(device, hostDevDir)
+		}
 	}
 
-	udevdCtrl := udevd.NewUdevdController()
+	udevdCtrl := udevd.NewUdevdController(c.ContainerID())
 
 	// lockFile := <container config path>/lock
 	// 1. use file lock, to make sure only one process to access this config file.
@@ -135,12 +199,28 @@ func AddDevice(c *container.Container, devices []*types.Device, opts *types.AddD
 	}
 	defer udevdCtrl.ToDisk()
 
+	registry, err := openRegistry()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := registry.close(); err != nil {
+			logrus.Errorf("Failed to save device registry: %v", err)
+		}
+	}()
+
 	var retErr []error
 	// add device and udpate cgroup here
 	for _, device := range devices {
+		// make sure no other container owns the device.
+		if err = registry.acquire(c.ContainerID(), device); err != nil {
+			retErr = append(retErr, err)
+			continue
+		}
 		// update config here
 		if err = config.UpdateDevice(device, true); err != nil {
 			retErr = append(retErr, err)
+			registry.release(c.ContainerID(), device)
 			continue
 		}
 
@@ -154,6 +234,7 @@ func AddDevice(c *container.Container, devices []*types.Device, opts *types.AddD
 			if err != nil {
 				retErr = append(retErr, err)
 				config.UpdateDevice(device, false)
+				registry.release(c.ContainerID(), device)
 				continue
 			}
 			if devType == "disk" {
@@ -165,20 +246,28 @@ func AddDevice(c *container.Container, devices []*types.Device, opts *types.AddD
 		// 2. container isn't running (pid==0)
 		if !opts.UpdateConfigOnly && c.Pid() > 0 && c.CheckPidExist() {
 			// add device to container.
-			if err = driver.AddDevice(pid, device, opts.Force); err != nil {
+			bindNode := device.BindNode
+			if err = AddDeviceNode(driver, c.GetSpec(), pid, "/", c.ContainerID(), device, opts.Force); err != nil {
 				retErr = append(retErr, err)
 				// roll back config and udev rules
 				config.UpdateDevice(device, false)
 				udevdCtrl.RemoveRule(r)
+				registry.release(c.ContainerID(), device)
 				continue
 			}
+			if device.BindNode != bindNode {
+				// fall back to bind mount, record it for prestart hook.
+				config.UpdateDevice(device, false)
+				config.UpdateDevice(device, true)
+			}
 			// update cgroup access permission.
 			if err = UpdateCgroupPermission(cgroupPath, device, true); err != nil {
 				retErr = append(retErr, err)
 				// roll back config and udev rules and remove device
-				driver.RemoveDevice(pid, device)
+				RemoveDeviceNode(driver, pid, c.ContainerID(), device, nil)
 				config.UpdateDevice(device, false)
 				udevdCtrl.RemoveRule(r)
+				registry.release(c.ContainerID(), device)
 				continue
 			}
 		}
@@ -223,6 +312,9 @@ func UpdateDevice(c *container.Container, opts *types.AddDeviceOptions) error {
 	if err := checkDevice(config, []*types.Device{}, opts); err != nil {
 		return err
 	}
+	if err := checkQosPolicy(c, opts); err != nil {
+		return err
+	}
 
 	defer func() {
 		if err := config.Flush(); err != nil {
@@ -237,8 +329,126 @@ func UpdateDevice(c *container.Container, opts *types.AddDeviceOptions) error {
 	return nil
 }
 
+// droppedPermissions returns the permissions in old but not in new
+func droppedPermissions(old, new string) string {
+	var dropped string
+	for _, p := range old {
+		if !strings.ContainsRune(new, p) {
+			dropped += string(p)
+		}
+	}
+	return dropped
+}
+
+// nodeModeForPermissions strips the read/write bits of node mode which are not allowed by permissions
+func nodeModeForPermissions(mode os.FileMode, permissions string) os.FileMode {
+	if !strings.ContainsRune(permissions, 'r') {
+		mode &^= 0444
+	}
+	if !strings.ContainsRune(permissions, 'w') {
+		mode &^= 0222
+	}
+	return mode
+}
+
+// UpdateDevicePermissions changes the cgroup permissions of added devices live,
+// and the mode of nodes in container if updateNode is set.
+func UpdateDevicePermissions(c *container.Container, devices []*types.Device, updateNode bool) error {
+	driver := nsexec.NewDefaultNsDriver()
+	pid := strconv.Itoa(c.Pid())
+
+	innerPath, err := c.GetCgroupPath()
+	if err != nil {
+		return err
+	}
+
+	cgroupPath, err := FindCgroupPath(pid, "devices", innerPath)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return err
+	}
+	defer config.Flush()
+
+	var retErr []error
+	for _, device := range devices {
+		found := config.FindDeviceByMapping(device)
+		if found == nil {
+			retErr = append(retErr, fmt.Errorf("device %s:%s is not added by syscontainer-tools", device.PathOnHost, device.Path))
+			continue
+		}
+		newDevice := *found
+		newDevice.Permissions = device.Permissions
+		if err := checkDevicePolicy(c, policy.OpUpdateDevice, []*types.Device{&newDevice}); err != nil {
+			retErr = append(retErr, err)
+			continue
+		}
+
+		if c.Pid() > 0 && c.CheckPidExist() {
+			// deny the dropped permissions only, access of kept ones is not interrupted.
+			if dropped := droppedPermissions(found.Permissions, newDevice.Permissions); dropped != "" {
+				denyDevice := *found
+				denyDevice.Permissions = dropped
+				if err := UpdateCgroupPermission(cgroupPath, &denyDevice, false); err != nil {
+					retErr = append(retErr, err)
+					continue
+				}
+			}
+			if err := UpdateCgroupPermission(cgroupPath, &newDevice, true); err != nil {
+				retErr = append(retErr, err)
+				continue
+			}
+			// the node of bind mounted device is owned by host, do not touch it.
+			if updateNode && !found.BindNode {
+				if err := updateNodeMode(driver, c, pid, &newDevice); err != nil {
+					retErr = append(retErr, err)
+				}
+			}
+		}
+
+		if err := config.UpdateDevicePermissions(&newDevice); err != nil {
+			retErr = append(retErr, err)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "Update permissions of device (%s) in container(%s,%s) to %s done.\n", newDevice.PathOnHost, c.Name(), newDevice.Path, newDevice.Permissions)
+		logrus.Infof("Update permissions of device (%s) in container(%s,%s) to %s done", newDevice.PathOnHost, c.Name(), newDevice.Path, newDevice.Permissions)
+	}
+
+	if len(retErr) == 0 {
+		return nil
+	}
+	for i := 0; i < len(retErr); i++ {
+		retErr[i] = fmt.Errorf("%s", retErr[i].Error())
+	}
+	return errors.New(strings.Trim(fmt.Sprint(retErr), "[]"))
+}
+
+// updateNodeMode re-applies owner and mode to the existing node in container.
+func updateNodeMode(driver nsexec.NsDriver, c *container.Container, pid string, device *types.Device) error {
+	node, err := DeviceFromPath(device.PathOnHost, device.Permissions)
+	if err != nil {
+		return err
+	}
+	node.Path = device.Path
+	node.NodeAttr = device.NodeAttr
+	if err := UpdateDeviceOwner(c.GetSpec(), node); err != nil {
+		return err
+	}
+	node.FileMode = nodeModeForPermissions(node.FileMode, device.Permissions)
+	// node exists in container, only its owner and mode will be changed.
+	return driver.AddDevice(pid, node, false)
+}
+
 // RemoveDevice will remove devices from container
-func RemoveDevice(c *container.Container, devices []*types.Device, followPartition bool) error {
+func RemoveDevice(c *container.Container, devices []*types.Device, opts *types.RemoveDeviceOptions) error {
 	driver := nsexec.NewDefaultNsDriver()
 	pid := strconv.Itoa(c.Pid())
 
@@ -263,7 +473,7 @@ func RemoveDevice(c *container.Container, devices []*types.Device, followPartiti
 	}
 	defer config.Flush()
 
-	udevdCtrl := udevd.NewUdevdController()
+	udevdCtrl := udevd.NewUdevdController(c.ContainerID())
 	if err := udevdCtrl.Lock(); err != nil {
 		return err
 	}
@@ -285,7 +495,7 @@ func RemoveDevice(c *container.Container, devices []*types.Device, followPartiti
 		}
 		newDevices = append(newDevices, newDevice)
 
-		if followPartition {
+		if opts.FollowPartition {
 			subDevices := config.FindSubPartition(newDevice)
 			for _, subDev := range subDevices {
 				// check the sub partition is added by syscontainer-tools
@@ -306,12 +516,23 @@ func RemoveDevice(c *container.Container, devices []*types.Device, followPartiti
 		}
 	}
 
+	registry, err := openRegistry()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := registry.close(); err != nil {
+			logrus.Errorf("Failed to save device registry: %v", err)
+		}
+	}()
+
 	for _, device := range newDevices {
 		// update config.
 		if err = config.UpdateDevice(device, false); err != nil {
 			retErr = append(retErr, err)
 			continue
 		}
+		registry.release(c.ContainerID(), device)
 		r := &udevd.Rule{
 			Name:       device.PathOnHost,
 			CtrDevName: device.Path,
@@ -321,8 +542,9 @@ func RemoveDevice(c *container.Container, devices []*types.Device, followPartiti
 
 		// only update for running container
 		if c.Pid() > 0 && c.CheckPidExist() {
-			if err = driver.RemoveDevice(pid, device); err != nil {
+			if err = RemoveDeviceNode(driver, pid, c.ContainerID(), device, opts); err != nil {
 				config.UpdateDevice(device, true)
+				registry.register(c.ContainerID(), device, sharingOf(device))
 				if device.Type != "c" {
 					devType, err := types.GetDeviceType(device.PathOnHost)
 					if err != nil {
@@ -353,6 +575,7 @@ func RemoveDevice(c *container.Container, devices []*types.Device, followPartiti
 			retErr = append(retErr, err)
 		}
 	}
+	retErr = append(retErr, removeCDIMounts(c, config, newDevices)...)
 
 	if len(retErr) == 0 {
 		return nil
@@ -387,10 +610,24 @@ func ListDevice(c *container.Container) ([]*hconfig.DeviceMapping, []*hconfig.De
 }
 
 // AddPath will add paths from host to container
-func AddPath(c *container.Container, binds []*types.Bind) error {
+func AddPath(c *container.Container, binds []*types.Bind, quota string) error {
 	driver := nsexec.NewDefaultNsDriver()
 	pid := strconv.Itoa(c.Pid())
 
+	var quotaSize int64
+	if quota != "" {
+		size, err := parseSize(quota)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("AddPath: invalid quota %q", quota)
+		}
+		for _, bind := range binds {
+			if !bind.IsDir {
+				return fmt.Errorf("AddPath: quota can only be set on directory, %s is not", bind.HostPath)
+			}
+		}
+		quotaSize = size
+	}
+
 	if err := c.Lock(); err != nil {
 		return fmt.Errorf("AddPath: failed to get lock, err: %s", err)
 	}
@@ -405,6 +642,9 @@ func AddPath(c *container.Container, binds []*types.Bind) error {
 	if err := config.CheckPathNum(); err != nil {
 		return err
 	}
+	if err := checkBindPolicy(c, binds); err != nil {
+		return err
+	}
 
 	var retErr []error
 	for _, bind := range binds {
@@ -414,9 +654,19 @@ func AddPath(c *container.Container, binds []*types.Bind) error {
 		if err != nil {
 			return fmt.Errorf("AddPath: failed to UpdateBind, err: %s", err)
 		}
+		quotaAdded := false
+		if quotaSize > 0 {
+			added, err := setPathQuota(c, config, bind.HostPath, quotaSize)
+			if err != nil {
+				config.UpdateBind(bind, false)
+				return fmt.Errorf("AddPath: failed to set quota on %s, err: %s", bind.HostPath, err)
+			}
+			quotaAdded = added
+		}
 
 		if c.Pid() > 0 && c.CheckPidExist() {
 			// 2. prepare transferpath if needed
+			bind.UsernsPath = utils.GetUsernsPath(c.GetSpec(), c.Pid())
 			if err := utils.PrepareTransferPath("/", c.ContainerID(), bind, !hostPathExist); err != nil {
 				config.UpdateBind(bind, false)
 
@@ -424,6 +674,9 @@ func AddPath(c *container.Container, binds []*types.Bind) error {
 				if !hostPathExist {
 					utils.RemoveTransferPath(c.ContainerID(), bind)
 				}
+				if quotaAdded {
+					releasePathQuota(c, config, bind.HostPath)
+				}
 				return fmt.Errorf("AddPath: failed to prepare transfer base, err: %s", err)
 			}
 			if err = driver.AddBind(pid, bind); err != nil {
@@ -432,6 +685,9 @@ func AddPath(c *container.Container, binds []*types.Bind) error {
 				if !hostPathExist {
 					utils.RemoveTransferPath(c.ContainerID(), bind)
 				}
+				if quotaAdded {
+					releasePathQuota(c, config, bind.HostPath)
+				}
 				return fmt.Errorf("AddPath: failed to add bind, err: %s", err)
 			}
 		}
@@ -451,9 +707,6 @@ func AddPath(c *container.Container, binds []*types.Bind) error {
 
 // RemovePath will remove paths from container
 func RemovePath(c *container.Container, binds []*types.Bind) error {
-
-	driver := nsexec.NewDefaultNsDriver()
-	pid := strconv.Itoa(c.Pid())
 	if err := c.Lock(); err != nil {
 		return err
 	}
@@ -465,6 +718,21 @@ func RemovePath(c *container.Container, binds []*types.Bind) error {
 	}
 	defer config.Flush()
 
+	retErr := removePaths(c, config, binds)
+	if len(retErr) == 0 {
+		return nil
+	}
+	for i := 0; i < len(retErr); i++ {
+		retErr[i] = fmt.Errorf("%s", retErr[i].Error())
+	}
+	return errors.New(strings.Trim(fmt.Sprint(retErr), "[]"))
+}
+
+// removePaths removes paths from container, the caller should hold the container lock.
+func removePaths(c *container.Container, config hconfig.ContainerConfig, binds []*types.Bind) []error {
+	driver := nsexec.NewDefaultNsDriver()
+	pid := strconv.Itoa(c.Pid())
+
 	var retErr []error
 	for _, bind := range binds {
 		mp, err := config.GetBindInConfig(bind)
@@ -500,12 +768,76 @@ func RemovePath(c *container.Container, binds []*types.Bind) error {
 				}
 			}
 		}
+		if removeHostPath {
+			if err := releasePathQuota(c, config, bind.HostPath); err != nil {
+				retErr = append(retErr, fmt.Errorf("Remove quota of path (%s) failed, err: %s", bind.HostPath, err))
+			}
+		}
 		msg := fmt.Sprintf("Remove path (%s) from container(%s,%s) done", bind.HostPath, c.Name(), bind.ContainerPath)
 		fmt.Fprintln(os.Stdout, msg)
 		logrus.Info(msg)
 
 	}
 
+	return retErr
+}
+
+// UpdatePath will change the mount options of paths in container
+func UpdatePath(c *container.Container, binds []*types.Bind) error {
+	driver := nsexec.NewDefaultNsDriver()
+	pid := strconv.Itoa(c.Pid())
+
+	if err := checkBindPolicy(c, binds); err != nil {
+		return err
+	}
+
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return err
+	}
+	defer config.Flush()
+
+	var retErr []error
+	for _, bind := range binds {
+		if mp, err := config.GetBindInConfig(bind); err == nil && mp != nil {
+			if err := checkRemountOption(mp.Permission, bind.MountOption, utils.HasUserns(c.GetSpec())); err != nil {
+				retErr = append(retErr, fmt.Errorf("Failed to update bind(%v), error: %s", bind, err))
+				continue
+			}
+		}
+		oldOption, err := config.UpdateBindOption(bind)
+		if err != nil {
+			retErr = append(retErr, err)
+			continue
+		}
+
+		if c.Pid() > 0 && c.CheckPidExist() {
+			// the mounts on host are remounted too, so they agree with the one in container.
+			if err := utils.RemountTransferPath(c.ContainerID(), bind); err != nil {
+				retErr = append(retErr, fmt.Errorf("Failed to update bind(%v), error: %s", bind, err))
+				bind.MountOption = oldOption
+				utils.RemountTransferPath(c.ContainerID(), bind)
+				config.UpdateBindOption(bind)
+				continue
+			}
+			if err := driver.RemountBind(pid, bind); err != nil {
+				retErr = append(retErr, fmt.Errorf("Failed to update bind(%v), error: %s", bind, err))
+				bind.MountOption = oldOption
+				utils.RemountTransferPath(c.ContainerID(), bind)
+				config.UpdateBindOption(bind)
+				continue
+			}
+		}
+		msg := fmt.Sprintf("Update path (%s) of container(%s,%s) to %s done.", bind.HostPath, c.Name(), bind.ContainerPath, bind.MountOption)
+		fmt.Fprintln(os.Stdout, msg)
+		logrus.Info(msg)
+	}
+
 	if len(retErr) == 0 {
 		return nil
 	}
@@ -515,8 +847,8 @@ func RemovePath(c *container.Container, binds []*types.Bind) error {
 	return errors.New(strings.Trim(fmt.Sprint(retErr), "[]"))
 }
 
-// ListPath list container paths
-func ListPath(ctr *container.Container) ([]string, error) {
+// ListPath list container paths with their mount status
+func ListPath(ctr *container.Container) ([]*PathStatus, error) {
 	if err := ctr.Lock(); err != nil {
 		return nil, err
 	}
@@ -526,13 +858,13 @@ func ListPath(ctr *container.Container) ([]string, error) {
 		return nil, err
 	}
 
-	return hConfig.GetBinds(), nil
+	return getPathStatus(ctr, hConfig.GetBinds(), hConfig.GetPathQuotas()), nil
 }
 
 func updateQos(config hconfig.ContainerConfig, pid, innerPath string, opts *types.AddDeviceOptions) error {
 	// update device read iops
 	for _, devReadIOPS := range opts.ReadIOPS {
-		if err := UpdateCgroupDeviceReadIOPS(pid, innerPath, devReadIOPS.String()); err != nil {
+		if err := UpdateCgroupDeviceReadIOPS(pid, innerPath, effectiveQos(config, hconfig.QosReadIOPS, devReadIOPS).String()); err != nil {
 			return err
 		}
 		if err := config.UpdateDeviceQos(devReadIOPS, hconfig.QosReadIOPS); err != nil {
@@ -545,7 +877,7 @@ func updateQos(config hconfig.ContainerConfig, pid, innerPath string, opts *type
 	}
 	// update device write iops
 	for _, devWriteIOPS := range opts.WriteIOPS {
-		if err := UpdateCgroupDeviceWriteIOPS(pid, innerPath, devWriteIOPS.String()); err != nil {
+		if err := UpdateCgroupDeviceWriteIOPS(pid, innerPath, effectiveQos(config, hconfig.QosWriteIOPS, devWriteIOPS).String()); err != nil {
 			return err
 		}
 		if err := config.UpdateDeviceQos(devWriteIOPS, hconfig.QosWriteIOPS); err != nil {
@@ -557,7 +889,7 @@ func updateQos(config hconfig.ContainerConfig, pid, innerPath string, opts *type
 	}
 	// update device read bps
 	for _, devReadBps := range opts.ReadBps {
-		if err := UpdateCgroupDeviceReadBps(pid, innerPath, devReadBps.String()); err != nil {
+		if err := UpdateCgroupDeviceReadBps(pid, innerPath, effectiveQos(config, hconfig.QosReadBps, devReadBps).String()); err != nil {
 			return err
 		}
 		if err := config.UpdateDeviceQos(devReadBps, hconfig.QosReadBps); err != nil {
@@ -570,7 +902,7 @@ func updateQos(config hconfig.ContainerConfig, pid, innerPath string, opts *type
 	}
 	// update device write bps
 	for _, devWriteBps := range opts.WriteBps {
-		if err := UpdateCgroupDeviceWriteBps(pid, innerPath, devWriteBps.String()); err != nil {
+		if err := UpdateCgroupDeviceWriteBps(pid, innerPath, effectiveQos(config, hconfig.QosWriteBps, devWriteBps).String()); err != nil {
 			return err
 		}
 		if err := config.UpdateDeviceQos(devWriteBps, hconfig.QosWriteBps); err != nil {
@@ -585,7 +917,7 @@ func updateQos(config hconfig.ContainerConfig, pid, innerPath string, opts *type
 	for _, devBlkioWeight := range opts.BlkioWeight {
 		cfqEnable, err := devBlkioWeight.GetCfqAbility()
 		if err == nil && cfqEnable {
-			if err := UpdateCgroupDeviceWeight(pid, innerPath, devBlkioWeight.String()); err != nil {
+			if err := UpdateCgroupDeviceWeight(pid, innerPath, effectiveQos(config, hconfig.QosBlkioWeight, devBlkioWeight).String()); err != nil {
 				return err
 			}
 			if err := config.UpdateDeviceQos(devBlkioWeight, hconfig.QosBlkioWeight); err != nil {
@@ -605,45 +937,79 @@ func updateQos(config hconfig.ContainerConfig, pid, innerPath string, opts *type
 	return nil
 }
 
+func qosCleanString(qos *types.Qos) string {
+	return fmt.Sprintf("%d:%d 0", qos.Major, qos.Minor)
+}
+
+// effectiveQos returns the qos to write to cgroup when qos is added, the strictest one
+// of the entries applied to the same device.
+func effectiveQos(config hconfig.ContainerConfig, qType hconfig.QosType, qos *types.Qos) *types.Qos {
+	entries := []*types.Qos{qos}
+	for _, q := range config.GetDeviceQos(qType) {
+		if q.Major != qos.Major || q.Minor != qos.Minor || q.Holder != qos.Holder {
+			entries = append(entries, q)
+		}
+	}
+	return hconfig.StrictestQos(entries, qos.Major, qos.Minor)
+}
+
+// leftQosString returns the qos to write to cgroup when qos is removed, the strictest one
+// of the entries left for the same device, or clean it if none.
+func leftQosString(config hconfig.ContainerConfig, qType hconfig.QosType, qos *types.Qos) string {
+	if left := hconfig.StrictestQos(config.GetDeviceQos(qType), qos.Major, qos.Minor); left != nil {
+		return left.String()
+	}
+	return qosCleanString(qos)
+}
+
 func removeQos(config hconfig.ContainerConfig, pid, innerPath string, device *types.Device) error {
-	cleanString := fmt.Sprintf("%d:%d 0", device.Major, device.Minor)
-	if exist, err := config.RemoveDeviceQos(device, hconfig.QosReadIOPS); err != nil {
+	if removed, err := config.RemoveDeviceQos(device, hconfig.QosReadIOPS); err != nil {
 		return err
-	} else if exist {
-		if err := UpdateCgroupDeviceReadIOPS(pid, innerPath, cleanString); err != nil {
-			return err
+	} else if len(removed) > 0 {
+		for _, qos := range removed {
+			if err := UpdateCgroupDeviceReadIOPS(pid, innerPath, leftQosString(config, hconfig.QosReadIOPS, qos)); err != nil {
+				return err
+			}
 		}
 		fmt.Fprintf(os.Stdout, "Remove read iops for device (%s) done.\n", device.PathOnHost)
 	}
-	if exist, err := config.RemoveDeviceQos(device, hconfig.QosWriteIOPS); err != nil {
+	if removed, err := config.RemoveDeviceQos(device, hconfig.QosWriteIOPS); err != nil {
 		return err
-	} else if exist {
-		if err := UpdateCgroupDeviceWriteIOPS(pid, innerPath, cleanString); err != nil {
-			return err
+	} else if len(removed) > 0 {
+		for _, qos := range removed {
+			if err := UpdateCgroupDeviceWriteIOPS(pid, innerPath, leftQosString(config, hconfig.QosWriteIOPS, qos)); err != nil {
+				return err
+			}
 		}
 		fmt.Fprintf(os.Stdout, "Remove write iops for device (%s) done.\n", device.PathOnHost)
 	}
-	if exist, err := config.RemoveDeviceQos(device, hconfig.QosReadBps); err != nil {
+	if removed, err := config.RemoveDeviceQos(device, hconfig.QosReadBps); err != nil {
 		return err
-	} else if exist {
-		if err := UpdateCgroupDeviceReadBps(pid, innerPath, cleanString); err != nil {
-			return err
+	} else if len(removed) > 0 {
+		for _, qos := range removed {
+			if err := UpdateCgroupDeviceReadBps(pid, innerPath, leftQosString(config, hconfig.QosReadBps, qos)); err != nil {
+				return err
+			}
 		}
 		fmt.Fprintf(os.Stdout, "Remove read bps for device (%s) done.\n", device.PathOnHost)
 	}
-	if exist, err := config.RemoveDeviceQos(device, hconfig.QosWriteBps); err != nil {
+	if removed, err := config.RemoveDeviceQos(device, hconfig.QosWriteBps); err != nil {
 		return err
-	} else if exist {
-		if err := UpdateCgroupDeviceWriteBps(pid, innerPath, cleanString); err != nil {
-			return err
+	} else if len(removed) > 0 {
+		for _, qos := range removed {
+			if err := UpdateCgroupDeviceWriteBps(pid, innerPath, leftQosString(config, hconfig.QosWriteBps, qos)); err != nil {
+				return err
+			}
 		}
 		fmt.Fprintf(os.Stdout, "Remove write bps for device (%s) done.\n", device.PathOnHost)
 	}
-	if exist, err := config.RemoveDeviceQos(device, hconfig.QosBlkioWeight); err != nil {
+	if removed, err := config.RemoveDeviceQos(device, hconfig.QosBlkioWeight); err != nil {
 		return err
-	} else if exist {
-		if err := UpdateCgroupDeviceWeight(pid, innerPath, cleanString); err != nil {
-			return err
+	} else if len(removed) > 0 {
+		for _, qos := range removed {
+			if err := UpdateCgroupDeviceWeight(pid, innerPath, leftQosString(config, hconfig.QosBlkioWeight, qos)); err != nil {
+				return err
+			}
 		}
 		fmt.Fprintf(os.Stdout, "Remove blkio weight for device (%s) done.\n", device.PathOnHost)
 	}
@@ -0,0 +1,57 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: device operation tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"isula.org/syscontainer-tools/types"
+)
+
+func TestUpdateDeviceOwner(t *testing.T) {
+	id := func(n uint32) *uint32 {
+		return &n
+	}
+	spec := &specs.Spec{
+		Linux: &specs.Linux{
+			Namespaces:  []specs.LinuxNamespace{{Type: specs.UserNamespace}},
+			UIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}},
+			GIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 200000, Size: 1000}},
+		},
+	}
+	tests := []struct {
+		attr     *types.NodeAttr
+		valid    bool
+		uid, gid uint32
+	}{
+		{nil, true, 100000, 200000},
+		{&types.NodeAttr{UID: id(1000), GID: id(5)}, true, 101000, 200005},
+		{&types.NodeAttr{UID: id(1000)}, true, 101000, 200000},
+		// gid 1000 is out of the mapping.
+		{&types.NodeAttr{UID: id(1000), GID: id(1000)}, false, 0, 0},
+		{&types.NodeAttr{UID: id(70000)}, false, 0, 0},
+	}
+	for _, tt := range tests {
+		device := &types.Device{Path: "/dev/test", NodeAttr: tt.attr}
+		err := UpdateDeviceOwner(spec, device)
+		if (err == nil) != tt.valid {
+			t.Errorf("UpdateDeviceOwner(%v) error = %v, want valid %v", tt.attr, err, tt.valid)
+			continue
+		}
+		if err == nil && (device.UID != tt.uid || device.GID != tt.gid) {
+			t.Errorf("UpdateDeviceOwner(%v) = %d:%d, want %d:%d", tt.attr, device.UID, device.GID, tt.uid, tt.gid)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: filesystem mount operation for container
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/libdevice/nsexec"
+	"isula.org/syscontainer-tools/types"
+	"isula.org/syscontainer-tools/utils"
+)
+
+// ParseMount checks the filesystem to mount, and returns the mount config.
+// Filesystems on block devices are mounted on host and propagated through the transfer path,
+// since the device node may not exist in container, others(eg: tmpfs, hugetlbfs) are mounted in container directly.
+func ParseMount(fsType, source, destination, options string) (*hconfig.MountMapping, *types.Device, error) {
+	if fsType == "" {
+		return nil, nil, fmt.Errorf("filesystem type should be specified")
+	}
+	if fsType == "bind" || fsType == "none" {
+		return nil, nil, fmt.Errorf("bind mount is not supported, please use add-path instead")
+	}
+	if !filepath.IsAbs(destination) {
+		return nil, nil, fmt.Errorf("destination should be an absolute path: %s", destination)
+	}
+	if source == "" {
+		source = fsType
+	}
+	m := &hconfig.MountMapping{
+		Source:      source,
+		Destination: filepath.Clean(destination),
+		Type:        fsType,
+		Options:     options,
+	}
+
+	if !filepath.IsAbs(source) {
+		return m, nil, nil
+	}
+	device, err := DeviceFromPath(source, "")
+	if err != nil {
+		if err == ErrNotADevice {
+			return nil, nil, fmt.Errorf("source %s is not a block device, please use add-path for host paths", source)
+		}
+		return nil, nil, err
+	}
+	if device.Type != "b" {
+		return nil, nil, fmt.Errorf("source %s is not a block device", source)
+	}
+	m.Transfer = true
+	return m, device, nil
+}
+
+// MountInContainer mounts the filesystem to container, rootfs is the path of container rootfs
+// in the mount namespace of pid, "/" for running container.
+func MountInContainer(driver nsexec.NsDriver, spec *specs.Spec, pid, rootfs, id string, m *hconfig.MountMapping) error {
+	mnt := &types.Mount{
+		Source:      m.Source,
+		Destination: m.Destination,
+		Type:        m.Type,
+		Options:     m.Options,
+	}
+	if spec != nil {
+		if uid, gid := utils.GetUIDGid(spec); uid != -1 && gid != -1 {
+			mnt.UID, mnt.GID = uid, gid
+		}
+	}
+
+	if m.Transfer {
+		bind, err := utils.PrepareTransferMount(rootfs, id, mnt)
+		if err != nil {
+			return err
+		}
+		if err := driver.AddBind(pid, bind); err != nil {
+			utils.RemoveTransferMount(id, m.Destination)
+			return err
+		}
+		return nil
+	}
+	mnt.Destination = filepath.Join(rootfs, m.Destination)
+	return driver.Mount(pid, mnt)
+}
+
+// AcquireMountDevice registers the block device of filesystem mounted through transfer path
+// to container, fails if it's attached to other containers.
+func AcquireMountDevice(id string, m *hconfig.MountMapping) error {
+	if !m.Transfer {
+		return nil
+	}
+	device, err := DeviceFromPath(m.Source, "")
+	if err != nil {
+		return err
+	}
+	registry, err := openRegistry()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := registry.close(); err != nil {
+			logrus.Errorf("Failed to save device registry: %v", err)
+		}
+	}()
+	return registry.acquire(id, device)
+}
+
+// ReleaseMountDevice unregisters the block device of filesystem mounted through transfer path from container
+func ReleaseMountDevice(id string, m *hconfig.MountMapping) error {
+	if !m.Transfer {
+		return nil
+	}
+	device, err := DeviceFromPath(m.Source, "")
+	if err != nil {
+		return err
+	}
+	registry, err := openRegistry()
+	if err != nil {
+		return err
+	}
+	registry.release(id, device)
+	return registry.close()
+}
+
+// AddMount will mount the filesystem to container, the block device which the filesystem
+// is on is refused if it's in use on host, unless forceUnsafe.
+func AddMount(c *container.Container, m *hconfig.MountMapping, device *types.Device, forceUnsafe bool) error {
+	driver := nsexec.NewDefaultNsDriver()
+	pid := strconv.Itoa(c.Pid())
+
+	if err := checkMountPolicy(c, m, device); err != nil {
+		return err
+	}
+	if device != nil && !forceUnsafe {
+		if err := checkDeviceSafety(device, []*types.Device{device}); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return err
+	}
+	defer config.Flush()
+
+	if err := config.UpdateMount(m, true); err != nil {
+		return err
+	}
+	// make sure no other container owns the device, it's held while the filesystem is mounted.
+	if err := AcquireMountDevice(c.ContainerID(), m); err != nil {
+		config.UpdateMount(m, false)
+		return err
+	}
+	if c.Pid() > 0 && c.CheckPidExist() {
+		if err := MountInContainer(driver, c.GetSpec(), pid, "/", c.ContainerID(), m); err != nil {
+			config.UpdateMount(m, false)
+			ReleaseMountDevice(c.ContainerID(), m)
+			return fmt.Errorf("failed to mount %s to %s in container: %v", m.Source, m.Destination, err)
+		}
+	} else if err := ReleaseMountDevice(c.ContainerID(), m); err != nil {
+		logrus.Errorf("Failed to release device of %s: %v", m.Source, err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Add mount (%s) to container(%s,%s) done.\n", m.Source, c.Name(), m.Destination)
+	logrus.Infof("Add mount (%s) to container(%s,%s) done", m.Source, c.Name(), m.Destination)
+	return nil
+}
+
+// RemoveMount will unmount the filesystem added by AddMount from container
+func RemoveMount(c *container.Container, destination string) error {
+	driver := nsexec.NewDefaultNsDriver()
+	pid := strconv.Itoa(c.Pid())
+
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return err
+	}
+	defer config.Flush()
+
+	m := config.FindMount(destination)
+	if m == nil {
+		return fmt.Errorf("%s is not mounted in container by syscontainer-tools", destination)
+	}
+	if c.Pid() > 0 && c.CheckPidExist() {
+		if err := driver.RemoveBind(pid, &types.Bind{ContainerPath: m.Destination}); err != nil {
+			return fmt.Errorf("failed to unmount %s in container: %v", m.Destination, err)
+		}
+	}
+	if m.Transfer {
+		if err := utils.RemoveTransferMount(c.ContainerID(), m.Destination); err != nil {
+			logrus.Errorf("Failed to remove transfer mount of %s: %v", m.Destination, err)
+		} else if err := ReleaseMountDevice(c.ContainerID(), m); err != nil {
+			logrus.Errorf("Failed to release device of %s: %v", m.Source, err)
+		}
+	}
+	if err := config.UpdateMount(m, false); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Remove mount (%s) from container(%s,%s) done.\n", m.Source, c.Name(), m.Destination)
+	logrus.Infof("Remove mount (%s) from container(%s,%s) done", m.Source, c.Name(), m.Destination)
+	return nil
+}
+
+// ListMount lists the filesystems mounted to container by AddMount
+func ListMount(c *container.Container) ([]*hconfig.MountMapping, error) {
+	if err := c.Lock(); err != nil {
+		return nil, err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return config.GetMounts(), nil
+}
@@ -0,0 +1,400 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: move device between containers
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/libdevice/nsexec"
+	"isula.org/syscontainer-tools/pkg/policy"
+	"isula.org/syscontainer-tools/pkg/udevd"
+	"isula.org/syscontainer-tools/types"
+)
+
+// moveEnd is the source or target container of device moving,
+// config and udev rules are opened under the lock of container.
+type moveEnd struct {
+	c          *container.Container
+	pid        string
+	innerPath  string
+	cgroupPath string
+	config     hconfig.ContainerConfig
+	udevdCtrl  udevd.Controller
+}
+
+func newMoveEnd(c *container.Container) (*moveEnd, error) {
+	pid := strconv.Itoa(c.Pid())
+	innerPath, err := c.GetCgroupPath()
+	if err != nil {
+		return nil, err
+	}
+	cgroupPath, err := FindCgroupPath(pid, "devices", innerPath)
+	if err != nil {
+		return nil, err
+	}
+	return &moveEnd{
+		c:          c,
+		pid:        pid,
+		innerPath:  innerPath,
+		cgroupPath: cgroupPath,
+		udevdCtrl:  udevd.NewUdevdController(c.ContainerID()),
+	}, nil
+}
+
+func (e *moveEnd) running() bool {
+	return e.c.Pid() > 0 && e.c.CheckPidExist()
+}
+
+func (e *moveEnd) udevRule(device *types.Device) *udevd.Rule {
+	return &udevd.Rule{
+		Name:       device.PathOnHost,
+		Container:  e.c.ContainerID(),
+		CtrDevName: device.Path,
+	}
+}
+
+// attach adds the device to container: config, udev rule, node and cgroup,
+// everything done is rolled back on failure.
+func (e *moveEnd) attach(driver nsexec.NsDriver, device *types.Device, force bool) error {
+	if err := e.config.UpdateDevice(device, true); err != nil {
+		return err
+	}
+	r := e.udevRule(device)
+	if device.Type != "c" {
+		devType, err := types.GetDeviceType(device.PathOnHost)
+		if err != nil {
+			e.config.UpdateDevice(device, false)
+			return err
+		}
+		if devType == "disk" {
+			e.udevdCtrl.AddRule(r)
+		}
+	}
+	if !e.running() {
+		return nil
+	}
+
+	bindNode := device.BindNode
+	if err := AddDeviceNode(driver, e.c.GetSpec(), e.pid, "/", e.c.ContainerID(), device, force); err != nil {
+		e.config.UpdateDevice(device, false)
+		e.udevdCtrl.RemoveRule(r)
+		return err
+	}
+	if device.BindNode != bindNode {
+		// fall back to bind mount, record it for prestart hook.
+		e.config.UpdateDevice(device, false)
+		e.config.UpdateDevice(device, true)
+	}
+	if err := UpdateCgroupPermission(e.cgroupPath, device, true); err != nil {
+		RemoveDeviceNode(driver, e.pid, e.c.ContainerID(), device, nil)
+		e.config.UpdateDevice(device, false)
+		e.udevdCtrl.RemoveRule(r)
+		return err
+	}
+	return nil
+}
+
+// detach removes the device from container: config, udev rule, node and cgroup,
+// QoS is left to be removed after the moving succeeds.
+func (e *moveEnd) detach(driver nsexec.NsDriver, device *types.Device) error {
+	if err := e.config.UpdateDevice(device, false); err != nil {
+		return err
+	}
+	e.udevdCtrl.RemoveRule(e.udevRule(device))
+	if !e.running() {
+		return nil
+	}
+
+	// refuse to move the device mounted in source container.
+	if err := RemoveDeviceNode(driver, e.pid, e.c.ContainerID(), device, &types.RemoveDeviceOptions{}); err != nil {
+		e.config.UpdateDevice(device, true)
+		e.udevdCtrl.AddRule(e.udevRule(device))
+		return err
+	}
+	if err := UpdateCgroupPermission(e.cgroupPath, device, false); err != nil {
+		// the node is gone, put the device back entirely.
+		if rErr := e.restore(driver, device); rErr != nil {
+			logrus.Errorf("Failed to restore device %s in container %s: %v", device.PathOnHost, e.c.Name(), rErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// restore attaches the device recorded in config back to container.
+func (e *moveEnd) restore(driver nsexec.NsDriver, device *types.Device) error {
+	node, err := DeviceFromPath(device.PathOnHost, device.Permissions)
+	if err != nil {
+		return err
+	}
+	*device = *mergeMovedDevice(node, device)
+	if err := UpdateDeviceOwner(e.c.GetSpec(), device); err != nil {
+		return err
+	}
+	if device.DiskLinks {
+		device.LinkPaths = FindDiskLinks(device, hostDevDir)
+	}
+	return e.attach(driver, device, true)
+}
+
+// lockMoveEnds locks the containers in order of container id, so two moving in
+// opposite directions will not dead lock.
+func lockMoveEnds(ends ...*moveEnd) (func(), error) {
+	if len(ends) == 2 && ends[0].c.ContainerID() > ends[1].c.ContainerID() {
+		ends = []*moveEnd{ends[1], ends[0]}
+	}
+	var unlocks []func() error
+	unlock := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, e := range ends {
+		if err := e.c.Lock(); err != nil {
+			unlock()
+			return nil, err
+		}
+		unlocks = append(unlocks, e.c.Unlock)
+	}
+	for _, e := range ends {
+		if err := e.udevdCtrl.Lock(); err != nil {
+			unlock()
+			return nil, err
+		}
+		unlocks = append(unlocks, e.udevdCtrl.Unlock)
+	}
+	return unlock, nil
+}
+
+// findMovingDevices returns the devices in source config to move, and the devices to add to target.
+func findMovingDevices(from, to *moveEnd, devices []*types.Device, followPartition bool) ([]*types.Device, []*types.Device, error) {
+	var srcDevices, dstDevices []*types.Device
+	seen := make(map[string]bool)
+	appendDevice := func(src *types.Device, path string, attr *types.NodeAttr) error {
+		if seen[src.PathOnHost] {
+			return nil
+		}
+		seen[src.PathOnHost] = true
+		node, err := DeviceFromPath(src.PathOnHost, src.Permissions)
+		if err != nil {
+			return err
+		}
+		dst := mergeMovedDevice(node, src)
+		dst.Path = path
+		if attr != nil {
+			dst.NodeAttr = attr
+		}
+		if err := UpdateDeviceOwner(to.c.GetSpec(), dst); err != nil {
+			return err
+		}
+		if dst.DiskLinks {
+			dst.LinkPaths = FindDiskLinks(dst, hostDevDir)
+		}
+		srcDevices = append(srcDevices, src)
+		dstDevices = append(dstDevices, dst)
+		return nil
+	}
+
+	for _, device := range devices {
+		index := from.config.DeviceIndexInArray(&types.Device{PathOnHost: device.PathOnHost})
+		if index == -1 {
+			return nil, nil, fmt.Errorf("device %s is not added to container %s by syscontainer-tools", device.PathOnHost, from.c.Name())
+		}
+		dm := from.config.GetAllDevices()[index]
+		src := from.config.FindDeviceByMapping(&types.Device{PathOnHost: dm.PathOnHost, Path: dm.PathInContainer})
+		path := device.Path
+		if path == "" {
+			path = src.Path
+		}
+		if err := appendDevice(src, path, device.NodeAttr); err != nil {
+			return nil, nil, err
+		}
+		if !followPartition {
+			continue
+		}
+		for _, part := range from.config.FindSubPartition(src) {
+			partSrc := from.config.FindDeviceByMapping(part)
+			if partSrc == nil {
+				continue
+			}
+			partPath := partSrc.Path
+			if path != src.Path {
+				// keep the partition suffix, eg: /dev/sdb1 ==> <container path>1
+				partPath = path + strings.TrimPrefix(filepath.Base(partSrc.PathOnHost), filepath.Base(src.PathOnHost))
+			}
+			if err := appendDevice(partSrc, partPath, device.NodeAttr); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return srcDevices, dstDevices, nil
+}
+
+// MoveDevice moves devices from one container to another under the locks of both containers,
+// the devices are given back to the source container if failed to add them to the target.
+func MoveDevice(from, to *container.Container, devices []*types.Device, followPartition bool, opts *types.AddDeviceOptions) error {
+	if from.ContainerID() == to.ContainerID() {
+		return fmt.Errorf("source and target container are the same one: %s", from.Name())
+	}
+	driver := nsexec.NewDefaultNsDriver()
+
+	src, err := newMoveEnd(from)
+	if err != nil {
+		return err
+	}
+	dst, err := newMoveEnd(to)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockMoveEnds(src, dst)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, e := range []*moveEnd{src, dst} {
+		config, err := hconfig.NewContainerConfig(e.c)
+		if err != nil {
+			return err
+		}
+		e.config = config
+		defer func(e *moveEnd) {
+			if err := e.config.Flush(); err != nil {
+				logrus.Infof("config Flush error:%v", err)
+			}
+		}(e)
+
+		if err := e.udevdCtrl.LoadRules(); err != nil {
+			return err
+		}
+		defer e.udevdCtrl.ToDisk()
+	}
+
+	srcDevices, dstDevices, err := findMovingDevices(src, dst, devices, followPartition)
+	if err != nil {
+		return err
+	}
+	if err := checkDevicePolicy(to, policy.OpAddDevice, dstDevices); err != nil {
+		return err
+	}
+	// the devices are in use by source container, only check the ones out of it.
+	if err := checkDevice(dst.config, dstDevices, opts); err != nil {
+		return err
+	}
+
+	registry, err := openRegistry()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := registry.close(); err != nil {
+			logrus.Errorf("Failed to save device registry: %v", err)
+		}
+	}()
+
+	if err := registry.move(from.ContainerID(), to.ContainerID(), srcDevices, dstDevices); err != nil {
+		return err
+	}
+
+	// a disk and its partitions are moved all or none, the ones moved are given back on failure.
+	var moveErr error
+	moved := 0
+	for i, srcDevice := range srcDevices {
+		dstDevice := dstDevices[i]
+		if err := src.detach(driver, srcDevice); err != nil {
+			moveErr = fmt.Errorf("failed to move device %s to container %s: %v", srcDevice.PathOnHost, to.Name(), err)
+			break
+		}
+		if err := dst.attach(driver, dstDevice, opts.Force); err != nil {
+			moveErr = fmt.Errorf("failed to move device %s to container %s: %v", srcDevice.PathOnHost, to.Name(), err)
+			if rErr := src.restore(driver, srcDevice); rErr != nil {
+				logrus.Errorf("Failed to restore device %s to container %s: %v", srcDevice.PathOnHost, from.Name(), rErr)
+				moveErr = fmt.Errorf("%v, and restore failed: %v", moveErr, rErr)
+			}
+			break
+		}
+		moved++
+	}
+	if moveErr != nil {
+		return moveBack(driver, src, dst, registry, srcDevices, dstDevices, moved, moveErr)
+	}
+
+	var retErr []error
+	for i, srcDevice := range srcDevices {
+		dstDevice := dstDevices[i]
+		if err := removeQos(src.config, src.pid, src.innerPath, srcDevice); err != nil {
+			retErr = append(retErr, err)
+		}
+		fmt.Fprintf(os.Stdout, "Move device (%s) from container(%s,%s) to container(%s,%s) done.\n", srcDevice.PathOnHost, from.Name(), srcDevice.Path, to.Name(), dstDevice.Path)
+		logrus.Infof("Move device (%s) from container(%s,%s) to container(%s,%s) done", srcDevice.PathOnHost, from.Name(), srcDevice.Path, to.Name(), dstDevice.Path)
+	}
+
+	if len(retErr) == 0 {
+		return nil
+	}
+	for i := 0; i < len(retErr); i++ {
+		retErr[i] = fmt.Errorf("%s", retErr[i].Error())
+	}
+	return errors.New(strings.Trim(fmt.Sprint(retErr), "[]"))
+}
+
+// moveBack gives the first moved devices back to the source container, and the whole set back
+// in the registry, the ones failed to give back are left in the target container.
+func moveBack(driver nsexec.NsDriver, src, dst *moveEnd, registry *deviceRegistry,
+	srcDevices, dstDevices []*types.Device, moved int, moveErr error) error {
+	retErr := []error{moveErr}
+	var leftSrc, leftDst []*types.Device
+	for i := moved - 1; i >= 0; i-- {
+		if err := dst.detach(driver, dstDevices[i]); err != nil {
+			retErr = append(retErr, fmt.Errorf("failed to give device %s back to container %s: %v", srcDevices[i].PathOnHost, src.c.Name(), err))
+			leftSrc, leftDst = append(leftSrc, srcDevices[i]), append(leftDst, dstDevices[i])
+			continue
+		}
+		if err := src.restore(driver, srcDevices[i]); err != nil {
+			retErr = append(retErr, fmt.Errorf("failed to restore device %s to container %s: %v", srcDevices[i].PathOnHost, src.c.Name(), err))
+		}
+	}
+	registry.moveBack(src.c.ContainerID(), dst.c.ContainerID(), srcDevices, dstDevices)
+	for i, device := range leftDst {
+		registry.release(src.c.ContainerID(), leftSrc[i])
+		registry.register(dst.c.ContainerID(), device, sharingOf(device))
+	}
+
+	for i := 0; i < len(retErr); i++ {
+		retErr[i] = fmt.Errorf("%s", retErr[i].Error())
+	}
+	return errors.New(strings.Trim(fmt.Sprint(retErr), "[]"))
+}
+
+// mergeMovedDevice fills the node of host device with the attributes recorded in config.
+func mergeMovedDevice(node, recorded *types.Device) *types.Device {
+	node.Path = recorded.Path
+	node.Parent = recorded.Parent
+	node.DmUUID = recorded.DmUUID
+	node.DiskLinks = recorded.DiskLinks
+	node.BindNode = recorded.BindNode
+	node.Sharing = recorded.Sharing
+	node.NodeAttr = recorded.NodeAttr
+	node.CDIDevice = recorded.CDIDevice
+	return node
+}
@@ -32,11 +32,13 @@ type NsDriver interface {
 	// Add device to container.
 	AddDevice(pid string, device *types.Device, force bool) error
 	// Remove device from container.
-	RemoveDevice(pid string, device *types.Device) error
+	RemoveDevice(pid string, device *types.Device, umount string, mountPoints []string) error
 	// Add a bind to container.
 	AddBind(pid string, bind *types.Bind) error
 	// Remove a bind from container.
 	RemoveBind(pid string, bind *types.Bind) error
+	// Change the mount options of a bind in container.
+	RemountBind(pid string, bind *types.Bind) error
 	// Add a transfer base for sharing
 	AddTransferBase(pid string, bind *types.Bind) error
 	// Update sysctl for userns enabled container
@@ -43,6 +43,8 @@ const (
 	UpdateSysctlMsg = 6
 	// MountMsg is a parent and child process message type, for remount /dev/ to remove nodev
 	MountMsg = 7
+	// RemountBindMsg is a parent and child process message type, for changing options of bind operation
+	RemountBindMsg = 8
 	// InitPipe is a parent and child process env name, used to pass the init pipe number to child process
 	InitPipe = "_LIBCONTAINER_INITPIPE"
 	// WorkType is a parent and child process env name, used to pass the work type to child process
@@ -134,11 +136,17 @@ func (ns *nsexecDriver) AddDevice(pid string, device *types.Device, force bool)
 }
 
 // RemoveDevice is a low level function which implements how to remove devices from a container.
-func (ns *nsexecDriver) RemoveDevice(pid string, device *types.Device) error {
+func (ns *nsexecDriver) RemoveDevice(pid string, device *types.Device, umount string, mountPoints []string) error {
 	namespaces := []string{"mnt"}
 	nsPaths := buildNSString(pid, namespaces)
 
-	return ns.exec(nsPaths, RemoveDeviceMsg, device)
+	msg := &types.RemoveDeviceMsg{
+		Device:      device,
+		MountPoints: mountPoints,
+		Umount:      umount,
+	}
+
+	return ns.exec(nsPaths, RemoveDeviceMsg, msg)
 }
 
 // AddTransferBase adds transfer path between container and host for sharing files
@@ -165,6 +173,14 @@ func (ns *nsexecDriver) RemoveBind(pid string, bind *types.Bind) error {
 	return ns.exec(nsPaths, RemoveBindMsg, bind)
 }
 
+// RemountBind is a low level function which implements how to change the mount options of binds in a container.
+func (ns *nsexecDriver) RemountBind(pid string, bind *types.Bind) error {
+	namespaces := []string{"mnt"}
+	nsPaths := buildNSString(pid, namespaces)
+
+	return ns.exec(nsPaths, RemountBindMsg, bind)
+}
+
 // UpdateSysctl is a low level function which implements how to update sysctl for a userns enabled contianer
 func (ns *nsexecDriver) UpdateSysctl(pid string, sysctl *types.Sysctl) error {
 	namespaces := []string{"ipc", "net", "mnt"}
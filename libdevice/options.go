@@ -135,3 +135,33 @@ func ParseAddDeviceBlkioWeight(vals []string) ([]*types.Qos, error) {
 	}
 	return devQos, nil
 }
+
+// ExpandQosToPhysical replaces the qos of device-mapper devices with the ones of
+// their underlying physical devices, other qos are returned as is.
+func ExpandQosToPhysical(qosArr []*types.Qos) ([]*types.Qos, error) {
+	var ret []*types.Qos
+	for _, qos := range qosArr {
+		dev, err := DeviceFromPath(qos.Path, "")
+		if err != nil {
+			return nil, err
+		}
+		if !IsDmDevice(dev) {
+			ret = append(ret, qos)
+			continue
+		}
+		physical, err := FindPhysicalDevices(dev)
+		if err != nil {
+			return nil, err
+		}
+		for _, pDev := range physical {
+			ret = append(ret, &types.Qos{
+				Path:   pDev.PathOnHost,
+				Major:  pDev.Major,
+				Minor:  pDev.Minor,
+				Value:  qos.Value,
+				Holder: qos.Path,
+			})
+		}
+	}
+	return ret, nil
+}
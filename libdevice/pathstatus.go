@@ -0,0 +1,168 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: mount status of paths added to container
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/utils"
+)
+
+// PathStatus is the path added to container along with its live mount status
+type PathStatus struct {
+	HostPath      string `json:"hostPath"`
+	ContainerPath string `json:"containerPath"`
+	Options       string `json:"options"`
+	UID           int    `json:"uid"`
+	GID           int    `json:"gid"`
+	HostExists    bool   `json:"hostExists"`
+	// TransferMounted is if the host path is mounted on the transfer path on host.
+	TransferMounted bool `json:"transferMounted"`
+	// ContainerMounted is if the path is mounted in container, false for stopped container.
+	ContainerMounted bool `json:"containerMounted"`
+	// Device and FsType are of the filesystem which host path is on.
+	Device       string `json:"device,omitempty"`
+	DeviceNumber string `json:"deviceNumber,omitempty"`
+	FsType       string `json:"fsType,omitempty"`
+	// Quota and QuotaUsed are the space limit and usage of project quota in bytes.
+	Quota     int64 `json:"quota,omitempty"`
+	QuotaUsed int64 `json:"quotaUsed,omitempty"`
+}
+
+// mountEntry is a mount in mountinfo
+type mountEntry struct {
+	number     string
+	mountPoint string
+	fsType     string
+	source     string
+}
+
+// parseMountEntries parses the mounts of mountinfo file
+func parseMountEntries(mountInfo string) ([]*mountEntry, error) {
+	f, err := os.Open(mountInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*mountEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || sep+2 >= len(fields) {
+			continue
+		}
+		entries = append(entries, &mountEntry{
+			number:     fields[2],
+			mountPoint: unescapeMountPath(fields[4]),
+			fsType:     fields[sep+1],
+			source:     fields[sep+2],
+		})
+	}
+	return entries, scanner.Err()
+}
+
+// isMounted checks if path is a mount point in entries
+func isMounted(entries []*mountEntry, path string) bool {
+	for _, e := range entries {
+		if e.mountPoint == path {
+			return true
+		}
+	}
+	return false
+}
+
+// findPathMount returns the mount which path is on, the one mounted last wins.
+func findPathMount(entries []*mountEntry, path string) *mountEntry {
+	var found *mountEntry
+	for _, e := range entries {
+		if path == e.mountPoint || strings.HasPrefix(path, strings.TrimSuffix(e.mountPoint, "/")+"/") {
+			if found == nil || len(e.mountPoint) >= len(found.mountPoint) {
+				found = e
+			}
+		}
+	}
+	return found
+}
+
+func getPathStatus(c *container.Container, binds []string, quotas []*hconfig.PathQuota) []*PathStatus {
+	uid, gid := 0, 0
+	if spec := c.GetSpec(); spec != nil {
+		if u, g := utils.GetUIDGid(spec); u != -1 && g != -1 {
+			uid, gid = u, g
+		}
+	}
+	hostMounts, err := parseMountEntries("/proc/self/mountinfo")
+	if err != nil {
+		logrus.Warnf("Failed to read mounts on host: %v", err)
+	}
+	var ctrMounts []*mountEntry
+	if c.Pid() > 0 && c.CheckPidExist() {
+		if ctrMounts, err = parseMountEntries(fmt.Sprintf("/proc/%d/mountinfo", c.Pid())); err != nil {
+			logrus.Warnf("Failed to read mounts in container: %v", err)
+		}
+	}
+
+	paths := []*PathStatus{}
+	for _, bind := range binds {
+		arr := strings.SplitN(bind, ":", 3)
+		for len(arr) < 3 {
+			arr = append(arr, "")
+		}
+		status := &PathStatus{
+			HostPath:      arr[0],
+			ContainerPath: arr[1],
+			Options:       arr[2],
+			UID:           uid,
+			GID:           gid,
+		}
+		if _, err := os.Stat(status.HostPath); err == nil {
+			status.HostExists = true
+		}
+		status.TransferMounted = isMounted(hostMounts, utils.GetTransferPath(c.ContainerID(), status.HostPath))
+		status.ContainerMounted = isMounted(ctrMounts, status.ContainerPath)
+
+		realPath, err := filepath.EvalSymlinks(status.HostPath)
+		if err != nil {
+			realPath = status.HostPath
+		}
+		if m := findPathMount(hostMounts, realPath); m != nil && status.HostExists {
+			status.Device = m.source
+			status.DeviceNumber = m.number
+			status.FsType = m.fsType
+		}
+		for _, q := range quotas {
+			if q.HostPath == status.HostPath && status.Device != "" {
+				status.QuotaUsed, status.Quota = getPathQuotaUsage(status.Device, q)
+			}
+		}
+		paths = append(paths, status)
+	}
+	return paths
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: path mount status tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testMountInfo = `21 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+22 21 0:20 / /proc rw,nosuid shared:2 - proc proc rw
+23 21 8:17 / /data rw,relatime shared:3 - xfs /dev/sdb1 rw,prjquota
+24 23 8:33 / /data/with\040space rw master:1 - ext4 /dev/sdc1 rw
+25 23 8:49 / /data/app rw shared:4 - xfs /dev/sdd1 rw
+26 25 8:50 / /data/app rw shared:5 - xfs /dev/sdd2 rw
+broken line
+`
+
+func TestParseMountEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries, err := parseMountEntries(writeTestFile(t, dir, "mountinfo", testMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("got %d entries, want 6", len(entries))
+	}
+	e := entries[3]
+	if e.number != "8:33" || e.mountPoint != "/data/with space" || e.fsType != "ext4" || e.source != "/dev/sdc1" {
+		t.Errorf("entry = %+v", e)
+	}
+	if !isMounted(entries, "/data") || isMounted(entries, "/data/other") {
+		t.Errorf("isMounted is wrong for /data or /data/other")
+	}
+}
+
+func TestFindPathMount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries, err := parseMountEntries(writeTestFile(t, dir, "mountinfo", testMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		source string
+	}{
+		{"/", "/dev/sda1"},
+		{"/root", "/dev/sda1"},
+		{"/data", "/dev/sdb1"},
+		{"/data/dir", "/dev/sdb1"},
+		{"/dataset", "/dev/sda1"},
+		{"/data/with space/dir", "/dev/sdc1"},
+		// the one mounted last wins.
+		{"/data/app/log", "/dev/sdd2"},
+	}
+	for _, tt := range tests {
+		m := findPathMount(entries, tt.path)
+		if m == nil || m.source != tt.source {
+			t.Errorf("findPathMount(%s) = %+v, want %s", tt.path, m, tt.source)
+		}
+	}
+	if m := findPathMount(nil, "/data"); m != nil {
+		t.Errorf("findPathMount in no mounts = %+v, want nil", m)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: enforce administrator policy
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/pkg/policy"
+	"isula.org/syscontainer-tools/types"
+)
+
+func policyRequest(c *container.Container, op string) *policy.Request {
+	req := &policy.Request{
+		Operation:   op,
+		Container:   c.Name(),
+		ContainerID: c.ContainerID(),
+	}
+	// container labels are passed to runtime as annotations.
+	if spec := c.GetSpec(); spec != nil {
+		req.Labels = spec.Annotations
+	}
+	return req
+}
+
+// checkDevicePolicy checks if the devices are allowed to attach to or update for the container
+func checkDevicePolicy(c *container.Container, op string, devices []*types.Device) error {
+	p, err := policy.Load(policy.DefaultPolicyFile)
+	if err != nil || p == nil {
+		return err
+	}
+	for _, device := range devices {
+		req := policyRequest(c, op)
+		req.Device = device
+		if err := p.Check(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkQosPolicy checks if the qos of devices are allowed to update for the container
+func checkQosPolicy(c *container.Container, opts *types.AddDeviceOptions) error {
+	var devices []*types.Device
+	for _, qosArr := range [][]*types.Qos{opts.ReadBps, opts.WriteBps, opts.ReadIOPS, opts.WriteIOPS, opts.BlkioWeight} {
+		for _, qos := range qosArr {
+			devices = append(devices, &types.Device{
+				Type:       "b",
+				PathOnHost: qos.Path,
+				Major:      qos.Major,
+				Minor:      qos.Minor,
+			})
+		}
+	}
+	return checkDevicePolicy(c, policy.OpUpdateDevice, devices)
+}
+
+// checkBindPolicy checks if the host paths are allowed to mount to the container
+func checkBindPolicy(c *container.Container, binds []*types.Bind) error {
+	p, err := policy.Load(policy.DefaultPolicyFile)
+	if err != nil || p == nil {
+		return err
+	}
+	for _, bind := range binds {
+		req := policyRequest(c, policy.OpAddPath)
+		// symlinks are resolved, or they could point out of the allowed paths.
+		path, err := filepath.EvalSymlinks(bind.HostPath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path %s for policy check: %v", bind.HostPath, err)
+		}
+		req.Path = path
+		req.MountOptions = strings.Split(bind.MountOption, ",")
+		if err := p.Check(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMountPolicy checks if the filesystem is allowed to mount to the container,
+// device is the block device which the filesystem is on, nil for others.
+func checkMountPolicy(c *container.Container, m *hconfig.MountMapping, device *types.Device) error {
+	p, err := policy.Load(policy.DefaultPolicyFile)
+	if err != nil || p == nil {
+		return err
+	}
+	req := policyRequest(c, policy.OpAddMount)
+	req.Device = device
+	if device == nil {
+		req.Path = m.Source
+		if filepath.IsAbs(m.Source) {
+			path, err := filepath.EvalSymlinks(m.Source)
+			if err != nil {
+				return fmt.Errorf("failed to resolve path %s for policy check: %v", m.Source, err)
+			}
+			req.Path = path
+		}
+	}
+	req.MountOptions = strings.Split(m.Options, ",")
+	return p.Check(req)
+}
+
+// checkImagePolicy checks if the image file of volume is allowed as host path, it's checked before
+// the image is created, the parent dir is resolved if the image does not exist yet.
+func checkImagePolicy(c *container.Container, v *hconfig.VolumeMapping) error {
+	p, err := policy.Load(policy.DefaultPolicyFile)
+	if err != nil || p == nil {
+		return err
+	}
+	path, err := filepath.EvalSymlinks(v.Image)
+	if os.IsNotExist(err) {
+		var dir string
+		if dir, err = filepath.EvalSymlinks(filepath.Dir(v.Image)); err == nil {
+			path = filepath.Join(dir, filepath.Base(v.Image))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s for policy check: %v", v.Image, err)
+	}
+	req := policyRequest(c, policy.OpAddMount)
+	req.Path = path
+	req.MountOptions = strings.Split(v.Options, ",")
+	return p.Check(req)
+}
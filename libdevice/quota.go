@@ -0,0 +1,232 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: project quota of paths added to container
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/pkg/quota"
+	"isula.org/syscontainer-tools/utils"
+)
+
+// quotaProjectIDBase is the first project id allocated, lower ones are left to the administrator.
+const quotaProjectIDBase = 100000
+
+var quotaLockFile = filepath.Join(hconfig.IsuladToolsDir, "path_quota.lock")
+
+// quotaFilesystems are the filesystems supporting project quota
+var quotaFilesystems = map[string]bool{"xfs": true, "ext4": true}
+
+// quotaDevice returns the device of filesystem which path is on
+func quotaDevice(path string) (string, error) {
+	mounts, err := parseMountEntries(mountInfoFile)
+	if err != nil {
+		return "", err
+	}
+	m := findPathMount(mounts, path)
+	if m == nil {
+		return "", fmt.Errorf("failed to find the filesystem of %s", path)
+	}
+	if !quotaFilesystems[m.fsType] {
+		return "", fmt.Errorf("%s is on %s, project quota is only supported on xfs and ext4", path, m.fsType)
+	}
+	return m.source, nil
+}
+
+// otherPathQuotas returns the path quotas and binds of all containers except c
+func otherPathQuotas(c *container.Container) ([]*hconfig.PathQuota, []string, error) {
+	storagePath, err := utils.GetContainerStoragePath()
+	if err != nil {
+		return nil, nil, err
+	}
+	configs, err := hconfig.LoadAllContainerHookConfigs(storagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var quotas []*hconfig.PathQuota
+	var binds []string
+	for id, hConfig := range configs {
+		if id != c.ContainerID() {
+			quotas = append(quotas, hConfig.GetPathQuotas()...)
+			binds = append(binds, hConfig.GetBinds()...)
+		}
+	}
+	return quotas, binds, nil
+}
+
+// pathInBinds checks if the host path is mounted by any of the binds saved in config
+func pathInBinds(binds []string, hostPath string) bool {
+	for _, bind := range binds {
+		if filepath.Clean(strings.SplitN(bind, ":", 2)[0]) == filepath.Clean(hostPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockQuota takes the host-wide lock of path quotas, project ids recorded in
+// device_hook.json of all containers are read and updated under it.
+func lockQuota() (*os.File, error) {
+	f, err := os.OpenFile(quotaLockFile, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlockQuota(f *os.File) {
+	unix.Flock(int(f.Fd()), unix.LOCK_UN)
+	f.Close()
+}
+
+// findPathQuota returns the quota of host path in quotas, nil if not found
+func findPathQuota(quotas []*hconfig.PathQuota, hostPath string) *hconfig.PathQuota {
+	for _, q := range quotas {
+		if q.HostPath == hostPath {
+			return q
+		}
+	}
+	return nil
+}
+
+// allocProjectID returns a project id not used by any of quotas
+func allocProjectID(quotas []*hconfig.PathQuota) uint32 {
+	id := uint32(quotaProjectIDBase)
+	for _, q := range quotas {
+		if q.ProjectID >= id {
+			id = q.ProjectID + 1
+		}
+	}
+	return id
+}
+
+// setPathQuota sets the project quota on host path and records it in config,
+// returns true if the quota is newly recorded for the container.
+func setPathQuota(c *container.Container, config hconfig.ContainerConfig, hostPath string, size int64) (bool, error) {
+	device, err := quotaDevice(hostPath)
+	if err != nil {
+		return false, err
+	}
+	lock, err := lockQuota()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock path quotas: %v", err)
+	}
+	defer unlockQuota(lock)
+
+	others, _, err := otherPathQuotas(c)
+	if err != nil {
+		return false, fmt.Errorf("failed to load quotas of other containers: %v", err)
+	}
+	quotas := append(others, config.GetPathQuotas()...)
+	if q := findPathQuota(quotas, hostPath); q != nil {
+		// the quota is shared by all containers using the path, it can't differ between them.
+		if q.Size != size {
+			return false, fmt.Errorf("%s already has quota %d bytes, conflicts with %d bytes", hostPath, q.Size, size)
+		}
+		if config.FindPathQuota(hostPath) != nil {
+			return false, nil
+		}
+		if err := config.UpdatePathQuota(&hconfig.PathQuota{HostPath: hostPath, ProjectID: q.ProjectID, Size: size}, true); err != nil {
+			return false, err
+		}
+		return true, config.Flush()
+	}
+
+	// a project id set by others, the administrator or another tool, must not be taken over.
+	current, err := quota.GetProjectID(hostPath)
+	if err != nil {
+		return false, err
+	}
+	if current != 0 {
+		return false, fmt.Errorf("%s already has project id %d which is not assigned by syscontainer-tools", hostPath, current)
+	}
+	q := &hconfig.PathQuota{HostPath: hostPath, ProjectID: allocProjectID(quotas), Size: size}
+	if err := quota.SetProjectID(hostPath, q.ProjectID); err != nil {
+		// the id may be applied to part of the tree.
+		quota.SetProjectID(hostPath, 0)
+		return false, err
+	}
+	if err := quota.SetLimit(device, q.ProjectID, size); err != nil {
+		if cErr := quota.SetProjectID(hostPath, 0); cErr != nil {
+			logrus.Errorf("Failed to clear project id of %s: %v", hostPath, cErr)
+		}
+		return false, err
+	}
+	if err := config.UpdatePathQuota(q, true); err != nil {
+		return false, err
+	}
+	// flush under the lock, so the id is seen by the next allocation.
+	return true, config.Flush()
+}
+
+// releasePathQuota removes the project quota from host path if no other container shares it
+func releasePathQuota(c *container.Container, config hconfig.ContainerConfig, hostPath string) error {
+	q := config.FindPathQuota(hostPath)
+	if q == nil {
+		return nil
+	}
+	lock, err := lockQuota()
+	if err != nil {
+		return fmt.Errorf("failed to lock path quotas: %v", err)
+	}
+	defer unlockQuota(lock)
+
+	if err := config.UpdatePathQuota(q, false); err != nil {
+		return err
+	}
+	if err := config.Flush(); err != nil {
+		return err
+	}
+	others, binds, err := otherPathQuotas(c)
+	if err != nil {
+		return fmt.Errorf("failed to load quotas of other containers: %v", err)
+	}
+	// the quota is kept while the path is mounted by other containers, even without quota record.
+	if findPathQuota(others, hostPath) != nil || pathInBinds(binds, hostPath) {
+		logrus.Infof("Project quota of %s is still used by other containers", hostPath)
+		return nil
+	}
+	if _, err := os.Stat(hostPath); os.IsNotExist(err) {
+		return nil
+	}
+	device, err := quotaDevice(hostPath)
+	if err != nil {
+		return err
+	}
+	if err := quota.SetLimit(device, q.ProjectID, 0); err != nil {
+		return err
+	}
+	return quota.SetProjectID(hostPath, 0)
+}
+
+// getPathQuotaUsage returns the space used and limit of quota on device
+func getPathQuotaUsage(device string, q *hconfig.PathQuota) (int64, int64) {
+	used, limit, err := quota.GetUsage(device, q.ProjectID)
+	if err != nil {
+		logrus.Warnf("Failed to get quota usage of %s: %v", q.HostPath, err)
+		return 0, q.Size
+	}
+	return used, limit
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: path quota tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"testing"
+
+	hconfig "isula.org/syscontainer-tools/config"
+)
+
+func TestAllocProjectID(t *testing.T) {
+	tests := []struct {
+		quotas []*hconfig.PathQuota
+		id     uint32
+	}{
+		{nil, quotaProjectIDBase},
+		// ids lower than base are left to the administrator.
+		{[]*hconfig.PathQuota{{HostPath: "/a", ProjectID: 10}}, quotaProjectIDBase},
+		{[]*hconfig.PathQuota{{HostPath: "/a", ProjectID: quotaProjectIDBase}}, quotaProjectIDBase + 1},
+		{[]*hconfig.PathQuota{
+			{HostPath: "/a", ProjectID: quotaProjectIDBase + 5},
+			{HostPath: "/b", ProjectID: quotaProjectIDBase + 2},
+		}, quotaProjectIDBase + 6},
+	}
+	for _, tt := range tests {
+		if id := allocProjectID(tt.quotas); id != tt.id {
+			t.Errorf("allocProjectID(%v) = %d, want %d", tt.quotas, id, tt.id)
+		}
+	}
+}
+
+func TestFindPathQuota(t *testing.T) {
+	quotas := []*hconfig.PathQuota{
+		{HostPath: "/a", ProjectID: quotaProjectIDBase},
+		{HostPath: "/b", ProjectID: quotaProjectIDBase + 1},
+	}
+	if q := findPathQuota(quotas, "/b"); q == nil || q.ProjectID != quotaProjectIDBase+1 {
+		t.Errorf("findPathQuota(/b) = %+v", q)
+	}
+	if q := findPathQuota(quotas, "/c"); q != nil {
+		t.Errorf("findPathQuota(/c) = %+v, want nil", q)
+	}
+}
+
+func TestPathInBinds(t *testing.T) {
+	binds := []string{"/a:/mnt/a:rw,rslave", "/b/:/mnt/b"}
+	tests := []struct {
+		hostPath string
+		found    bool
+	}{
+		{"/a", true},
+		{"/b", true},
+		{"/mnt/a", false},
+		{"/c", false},
+	}
+	for _, tt := range tests {
+		if found := pathInBinds(binds, tt.hostPath); found != tt.found {
+			t.Errorf("pathInBinds(%v, %s) = %v, want %v", binds, tt.hostPath, found, tt.found)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: host-wide device ownership registry
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/types"
+	"isula.org/syscontainer-tools/utils"
+)
+
+const (
+	// SharingExclusive means the device could be attached to one container only, default for block devices
+	SharingExclusive = "exclusive"
+	// SharingShared means the device could be attached to several containers, default for char devices
+	SharingShared = "shared"
+)
+
+var (
+	// registry is in tmpfs, it's rebuilt from device_hook.json of all containers after reboot.
+	registryFile     = filepath.Join(hconfig.IsuladToolsDir, "device_registry.json")
+	registryLockFile = filepath.Join(hconfig.IsuladToolsDir, "device_registry.lock")
+)
+
+type registryEntry struct {
+	PathOnHost string            `json:"pathOnHost"`
+	Owners     map[string]string `json:"owners"` // container id ==> sharing mode
+}
+
+type deviceRegistry struct {
+	Devices map[string]*registryEntry `json:"devices"`
+	lock    *os.File
+	dirty   bool
+	// related returns the keys of devices sharing storage with the device, relatedKeys if nil.
+	related func(device *types.Device) []string
+}
+
+func registryKey(devType string, major, minor int64) string {
+	return fmt.Sprintf("%s %d:%d", devType, major, minor)
+}
+
+// DefaultSharing returns the sharing mode of device if not specified by user
+func DefaultSharing(device *types.Device) string {
+	if device.Type == "b" {
+		return SharingExclusive
+	}
+	return SharingShared
+}
+
+// openRegistry locks and loads the registry, rebuilds it if missing.
+func openRegistry() (*deviceRegistry, error) {
+	f, err := os.OpenFile(registryLockFile, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r := &deviceRegistry{Devices: make(map[string]*registryEntry), lock: f}
+	data, err := ioutil.ReadFile(registryFile)
+	if err == nil {
+		if err := json.Unmarshal(data, r); err == nil {
+			r.prune()
+			return r, nil
+		}
+		logrus.Warnf("device registry %s is corrupted, rebuild it", registryFile)
+	} else if !os.IsNotExist(err) {
+		r.close()
+		return nil, err
+	}
+	if err := r.rebuild(); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// rebuild collects the devices from device_hook.json of all containers
+func (r *deviceRegistry) rebuild() error {
+	r.Devices = make(map[string]*registryEntry)
+	r.dirty = true
+	storagePath, err := utils.GetContainerStoragePath()
+	if err != nil {
+		// no container at all.
+		return nil
+	}
+	configs, err := hconfig.LoadAllContainerHookConfigs(storagePath)
+	if err != nil {
+		return err
+	}
+	for id, hConfig := range configs {
+		for _, dm := range hConfig.GetAllDevices() {
+			device := &types.Device{
+				Type:       dm.Type,
+				Major:      dm.Major,
+				Minor:      dm.Minor,
+				PathOnHost: dm.PathOnHost,
+				Sharing:    dm.Sharing,
+			}
+			r.register(id, device, sharingOf(device))
+		}
+	}
+	logrus.Infof("Device registry rebuilt with %d devices of %d containers", len(r.Devices), len(configs))
+	return nil
+}
+
+// prune drops the owners which are removed containers, they are released by remove-device only,
+// a device attached to a removed container would be blocked otherwise.
+func (r *deviceRegistry) prune() {
+	storagePath, err := utils.GetContainerStoragePath()
+	if err != nil {
+		// without the container storage, all owners look removed, keep them.
+		return
+	}
+	for key, entry := range r.Devices {
+		for id := range entry.Owners {
+			if _, err := os.Stat(filepath.Join(storagePath, id)); os.IsNotExist(err) {
+				logrus.Infof("Release device %s of removed container %s", entry.PathOnHost, id)
+				delete(entry.Owners, id)
+				r.dirty = true
+			}
+		}
+		if len(entry.Owners) == 0 {
+			delete(r.Devices, key)
+			r.dirty = true
+		}
+	}
+}
+
+func sharingOf(device *types.Device) string {
+	if device.Sharing != "" {
+		return device.Sharing
+	}
+	return DefaultSharing(device)
+}
+
+func (r *deviceRegistry) register(id string, device *types.Device, sharing string) {
+	key := registryKey(device.Type, device.Major, device.Minor)
+	entry, ok := r.Devices[key]
+	if !ok {
+		entry = &registryEntry{PathOnHost: device.PathOnHost, Owners: make(map[string]string)}
+		r.Devices[key] = entry
+	}
+	entry.Owners[id] = sharing
+	r.dirty = true
+}
+
+// relatedKeys returns the keys of devices sharing the same storage with the device,
+// the partitions, holders and underlying devices of a block device.
+func relatedKeys(device *types.Device) []string {
+	keys := []string{registryKey(device.Type, device.Major, device.Minor)}
+	if device.Type != "b" {
+		return keys
+	}
+	for num := range blockDeviceFamily(device) {
+		keys = append(keys, "b "+num)
+	}
+	for _, num := range lowerBlockDevices(device) {
+		keys = append(keys, "b "+num)
+	}
+	return keys
+}
+
+// lowerBlockDevices returns the disk of a partition and slaves of a stacked device recursively.
+func lowerBlockDevices(device *types.Device) []string {
+	var nums []string
+	var walk func(sysPath string, depth int)
+	walk = func(sysPath string, depth int) {
+		if depth > maxDeviceStackDepth {
+			return
+		}
+		if _, err := os.Stat(filepath.Join(sysPath, "partition")); err == nil {
+			disk := filepath.Dir(sysPath)
+			if num := readSysfsValue(filepath.Join(disk, "dev")); num != "" {
+				nums = append(nums, num)
+				walk(disk, depth+1)
+			}
+			return
+		}
+		for _, slave := range listSysfsDir(filepath.Join(sysPath, "slaves")) {
+			slavePath := GetDeviceRealPath(filepath.Join(sysBlockDir, slave))
+			if num := readSysfsValue(filepath.Join(slavePath, "dev")); num != "" {
+				nums = append(nums, num)
+				walk(slavePath, depth+1)
+			}
+		}
+	}
+	walk(GetDeviceRealPath(sysfsBlockPath(device.Major, device.Minor)), 0)
+	return nums
+}
+
+// acquire registers the device to container, fails if it conflicts with other containers.
+func (r *deviceRegistry) acquire(id string, device *types.Device) error {
+	sharing := device.Sharing
+	if sharing == "" {
+		sharing = r.parentSharing(id, device)
+	}
+	related := r.related
+	if related == nil {
+		related = relatedKeys
+	}
+	for _, key := range related(device) {
+		entry, ok := r.Devices[key]
+		if !ok {
+			continue
+		}
+		for owner, mode := range entry.Owners {
+			if owner == id {
+				continue
+			}
+			if mode == SharingExclusive || sharing == SharingExclusive {
+				return fmt.Errorf("device %s conflicts with %s attached to container %s in %s mode, use --shared for both to share it",
+					device.PathOnHost, entry.PathOnHost, owner, mode)
+			}
+		}
+	}
+	// record the inherited mode, so it's kept when the registry is rebuilt from config.
+	device.Sharing = sharing
+	r.register(id, device, sharing)
+	return nil
+}
+
+// parentSharing returns the sharing mode of the parent disk in the container for partitions,
+// so partitions added by udev follow their disk.
+func (r *deviceRegistry) parentSharing(id string, device *types.Device) string {
+	if device.Parent != "" {
+		if parent, err := DeviceFromPath(device.Parent, ""); err == nil {
+			if entry, ok := r.Devices[registryKey(parent.Type, parent.Major, parent.Minor)]; ok {
+				if mode, ok := entry.Owners[id]; ok {
+					return mode
+				}
+			}
+		}
+	}
+	return DefaultSharing(device)
+}
+
+// release unregisters the device from container
+func (r *deviceRegistry) release(id string, device *types.Device) {
+	key := registryKey(device.Type, device.Major, device.Minor)
+	entry, ok := r.Devices[key]
+	if !ok {
+		return
+	}
+	if _, ok := entry.Owners[id]; !ok {
+		return
+	}
+	delete(entry.Owners, id)
+	if len(entry.Owners) == 0 {
+		delete(r.Devices, key)
+	}
+	r.dirty = true
+}
+
+// move moves the devices from one container to another, srcDevices and dstDevices are in pairs.
+// All the source devices are released before acquiring, or a disk moved along with its partitions
+// would conflict with them. Nothing is changed if failed.
+func (r *deviceRegistry) move(from, to string, srcDevices, dstDevices []*types.Device) error {
+	for _, device := range srcDevices {
+		r.release(from, device)
+	}
+	for i, device := range dstDevices {
+		if err := r.acquire(to, device); err != nil {
+			r.moveBack(from, to, srcDevices, dstDevices[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// moveBack gives the devices moved by move back to the source container
+func (r *deviceRegistry) moveBack(from, to string, srcDevices, dstDevices []*types.Device) {
+	for _, device := range dstDevices {
+		r.release(to, device)
+	}
+	for _, device := range srcDevices {
+		r.register(from, device, sharingOf(device))
+	}
+}
+
+// close saves the registry if changed and releases the lock
+func (r *deviceRegistry) close() error {
+	defer func() {
+		unix.Flock(int(r.lock.Fd()), unix.LOCK_UN)
+		r.lock.Close()
+	}()
+	if !r.dirty {
+		return nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	tmp := registryFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, registryFile)
+}
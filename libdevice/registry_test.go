@@ -0,0 +1,136 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: device registry tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"testing"
+
+	"isula.org/syscontainer-tools/types"
+)
+
+// testRegistry returns a registry whose related devices are given by family,
+// keyed by the device and valued by the keys sharing storage with it.
+func testRegistry(family map[string][]string) *deviceRegistry {
+	return &deviceRegistry{
+		Devices: make(map[string]*registryEntry),
+		related: func(device *types.Device) []string {
+			key := registryKey(device.Type, device.Major, device.Minor)
+			return append([]string{key}, family[key]...)
+		},
+	}
+}
+
+func blockDevice(path string, major, minor int64) *types.Device {
+	return &types.Device{Type: "b", PathOnHost: path, Major: major, Minor: minor}
+}
+
+func owners(r *deviceRegistry, device *types.Device) map[string]string {
+	entry, ok := r.Devices[registryKey(device.Type, device.Major, device.Minor)]
+	if !ok {
+		return nil
+	}
+	return entry.Owners
+}
+
+func TestRegistryAcquire(t *testing.T) {
+	r := testRegistry(map[string][]string{
+		"b 8:0":  {"b 8:1"},
+		"b 8:1":  {"b 8:0"},
+		"b 8:16": nil,
+	})
+	sda := blockDevice("/dev/sda", 8, 0)
+	sda1 := blockDevice("/dev/sda1", 8, 1)
+	sdb := blockDevice("/dev/sdb", 8, 16)
+
+	if err := r.acquire("c1", sda); err != nil {
+		t.Fatalf("acquire sda failed: %v", err)
+	}
+	// block device is exclusive by default, its partition conflicts too.
+	if err := r.acquire("c2", sda1); err == nil {
+		t.Errorf("partition of exclusive disk should not be acquired by another container")
+	}
+	if err := r.acquire("c1", sda1); err != nil {
+		t.Errorf("the owner should acquire the partition: %v", err)
+	}
+	if sda1.Sharing != SharingExclusive {
+		t.Errorf("sharing mode of sda1 = %s, want %s", sda1.Sharing, SharingExclusive)
+	}
+
+	sdb.Sharing = SharingShared
+	if err := r.acquire("c1", sdb); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.acquire("c2", &types.Device{Type: "b", PathOnHost: "/dev/sdb", Major: 8, Minor: 16, Sharing: SharingShared}); err != nil {
+		t.Errorf("shared device should be acquired by both: %v", err)
+	}
+	if err := r.acquire("c3", blockDevice("/dev/sdb", 8, 16)); err == nil {
+		t.Errorf("exclusive acquiring should conflict with shared owners")
+	}
+	if o := owners(r, sdb); len(o) != 2 {
+		t.Errorf("owners of sdb = %v, want c1 and c2", o)
+	}
+
+	r.release("c1", sda)
+	r.release("c1", sda1)
+	if len(owners(r, sda)) != 0 || len(owners(r, sda1)) != 0 {
+		t.Errorf("sda and sda1 should be released")
+	}
+	if err := r.acquire("c2", sda1); err != nil {
+		t.Errorf("released partition should be acquired: %v", err)
+	}
+}
+
+func TestRegistryMoveDiskWithPartitions(t *testing.T) {
+	family := map[string][]string{
+		"b 8:0": {"b 8:1", "b 8:2"},
+		"b 8:1": {"b 8:0"},
+		"b 8:2": {"b 8:0"},
+	}
+	r := testRegistry(family)
+	var src, dst []*types.Device
+	for _, d := range []*types.Device{blockDevice("/dev/sda", 8, 0), blockDevice("/dev/sda1", 8, 1), blockDevice("/dev/sda2", 8, 2)} {
+		if err := r.acquire("c1", d); err != nil {
+			t.Fatal(err)
+		}
+		src = append(src, d)
+		dst = append(dst, blockDevice(d.PathOnHost, d.Major, d.Minor))
+	}
+
+	// the disk comes first, it must not conflict with its partitions still owned by source.
+	if err := r.move("c1", "c2", src, dst); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	for _, d := range dst {
+		if o := owners(r, d); len(o) != 1 || o["c2"] != SharingExclusive {
+			t.Errorf("owners of %s = %v, want c2 only", d.PathOnHost, o)
+		}
+	}
+
+	// a conflict with another container gives the whole set back.
+	r.moveBack("c1", "c2", src, dst)
+	if err := r.acquire("c3", &types.Device{Type: "b", PathOnHost: "/dev/sda2", Major: 8, Minor: 2, Sharing: SharingShared}); err == nil {
+		t.Fatalf("sda2 should conflict with c1")
+	}
+	r.Devices["b 8:2"].Owners["c3"] = SharingShared
+	dst = []*types.Device{blockDevice("/dev/sda", 8, 0), blockDevice("/dev/sda1", 8, 1), blockDevice("/dev/sda2", 8, 2)}
+	if err := r.move("c1", "c2", src, dst); err == nil {
+		t.Fatalf("move should conflict with c3")
+	}
+	for _, d := range src {
+		o := owners(r, d)
+		if _, ok := o["c2"]; ok || o["c1"] != SharingExclusive {
+			t.Errorf("owners of %s = %v, should be given back to c1", d.PathOnHost, o)
+		}
+	}
+}
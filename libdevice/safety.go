@@ -0,0 +1,221 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: check if host device is safe to add to container
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"isula.org/syscontainer-tools/types"
+)
+
+const (
+	mountInfoFile = "/proc/self/mountinfo"
+	swapsFile     = "/proc/swaps"
+)
+
+func devNumString(major, minor int64) string {
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
+// blockDeviceFamily returns the block device, its partitions and the devices stacked on them,
+// keyed by "major:minor", valued by kernel name.
+func blockDeviceFamily(device *types.Device) map[string]string {
+	family := make(map[string]string)
+
+	var walk func(sysPath string, depth int)
+	walk = func(sysPath string, depth int) {
+		num := readSysfsValue(filepath.Join(sysPath, "dev"))
+		if num == "" || depth > maxDeviceStackDepth {
+			return
+		}
+		if _, ok := family[num]; ok {
+			return
+		}
+		family[num] = filepath.Base(GetDeviceRealPath(sysPath))
+
+		// partitions are sub dirs with "partition" file.
+		for _, name := range listSysfsDir(sysPath) {
+			if _, err := os.Stat(filepath.Join(sysPath, name, "partition")); err == nil {
+				walk(filepath.Join(sysPath, name), depth+1)
+			}
+		}
+		for _, holder := range listSysfsDir(filepath.Join(sysPath, "holders")) {
+			walk(filepath.Join(sysBlockDir, holder), depth+1)
+		}
+	}
+	walk(GetDeviceRealPath(sysfsBlockPath(device.Major, device.Minor)), 0)
+	return family
+}
+
+// mountPoint is a filesystem mounted on a device
+type mountPoint struct {
+	name string // kernel name of the device
+	path string
+}
+
+// unescapeMountPath decodes the octal escapes(eg: \040 for space) of path in mountinfo
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+	var buf []byte
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				buf = append(buf, byte(v))
+				i += 3
+				continue
+			}
+		}
+		buf = append(buf, path[i])
+	}
+	return string(buf)
+}
+
+// findMountPoints returns the mount points of devices in family listed in the mountinfo file
+func findMountPoints(mountInfo string, family map[string]string) ([]mountPoint, error) {
+	f, err := os.Open(mountInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mounts []mountPoint
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if name, ok := family[fields[2]]; ok {
+			mounts = append(mounts, mountPoint{name: name, path: unescapeMountPath(fields[4])})
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// findMounted returns the mount points of devices in family on host
+func findMounted(family map[string]string) ([]string, error) {
+	mounts, err := findMountPoints(mountInfoFile, family)
+	if err != nil {
+		return nil, err
+	}
+	var reasons []string
+	for _, m := range mounts {
+		reasons = append(reasons, fmt.Sprintf("%s is mounted on %s", m.name, m.path))
+	}
+	return reasons, nil
+}
+
+// findContainerMounts returns the paths in container where the device or its partitions are mounted,
+// the nested ones come first so they can be unmounted in order.
+func findContainerMounts(pid string, device *types.Device) ([]string, error) {
+	family := map[string]string{devNumString(device.Major, device.Minor): filepath.Base(device.PathOnHost)}
+	if device.Type == "b" {
+		for num, name := range blockDeviceFamily(device) {
+			family[num] = name
+		}
+	}
+	mounts, err := findMountPoints(filepath.Join("/proc", pid, "mountinfo"), family)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for i := len(mounts) - 1; i >= 0; i-- {
+		paths = append(paths, mounts[i].path)
+	}
+	return paths, nil
+}
+
+// findSwap returns the devices in family used as swap on host
+func findSwap(family map[string]string) ([]string, error) {
+	f, err := os.Open(swapsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reasons []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[1] != "partition" {
+			continue
+		}
+		dev, err := DeviceFromPath(fields[0], "")
+		if err != nil {
+			continue
+		}
+		if name, ok := family[devNumString(dev.Major, dev.Minor)]; ok {
+			reasons = append(reasons, fmt.Sprintf("%s is used as swap", name))
+		}
+	}
+	return reasons, scanner.Err()
+}
+
+// findHolders returns the active dm/md devices stacked on the device or its partitions,
+// the ones being added together(eg: --follow-holders) are excluded.
+func findHolders(family map[string]string, devs []*types.Device) []string {
+	adding := make(map[string]bool)
+	for _, dev := range devs {
+		adding[devNumString(dev.Major, dev.Minor)] = true
+	}
+	var reasons []string
+	for num, name := range family {
+		if adding[num] {
+			continue
+		}
+		// partitions are not holders.
+		if _, err := os.Stat(filepath.Join(sysBlockDir, name)); err != nil {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("%s is stacked on it", name))
+	}
+	return reasons
+}
+
+// checkDeviceSafety refuses the block device which is in use on host,
+// devices attached to other containers are checked by the device registry.
+// devs are all the devices being added with it.
+func checkDeviceSafety(device *types.Device, devs []*types.Device) error {
+	if device.Type != "b" {
+		return nil
+	}
+	// the device can't be proved unused if its usage is unknown.
+	family := blockDeviceFamily(device)
+	if len(family) == 0 {
+		return fmt.Errorf("failed to find device %s in sysfs, use --force-unsafe to add it anyway", device.PathOnHost)
+	}
+
+	reasons, err := findMounted(family)
+	if err != nil {
+		return fmt.Errorf("failed to check mounts of device %s: %v, use --force-unsafe to add it anyway", device.PathOnHost, err)
+	}
+	swaps, err := findSwap(family)
+	if err != nil {
+		return fmt.Errorf("failed to check swaps of device %s: %v, use --force-unsafe to add it anyway", device.PathOnHost, err)
+	}
+	reasons = append(reasons, swaps...)
+	reasons = append(reasons, findHolders(family, devs)...)
+	if len(reasons) == 0 {
+		return nil
+	}
+	return fmt.Errorf("device %s is in use: %s, use --force-unsafe to add it anyway", device.PathOnHost, strings.Join(reasons, "; "))
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: host device safety check tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnescapeMountPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/mnt/data", "/mnt/data"},
+		{"/mnt/my\\040data", "/mnt/my data"},
+		{"/mnt/a\\011b\\134c", "/mnt/a\tb\\c"},
+		// invalid escapes are kept as is.
+		{"/mnt/a\\9", "/mnt/a\\9"},
+	}
+	for _, tt := range tests {
+		if got := unescapeMountPath(tt.path); got != tt.want {
+			t.Errorf("unescapeMountPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFindMountPoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "safety")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mountInfo := filepath.Join(dir, "mountinfo")
+	data := `22 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw
+36 22 8:17 / /mnt/my\040data rw,relatime shared:2 - xfs /dev/sdb1 rw
+37 22 8:18 / /mnt/b rw,relatime shared:3 - xfs /dev/sdb2 rw
+38 37 8:17 /sub /mnt/b/sub rw,relatime shared:2 - xfs /dev/sdb1 rw
+`
+	if err := ioutil.WriteFile(mountInfo, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	family := map[string]string{"8:16": "sdb", "8:17": "sdb1"}
+	mounts, err := findMountPoints(mountInfo, family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mountPoint{{name: "sdb1", path: "/mnt/my data"}, {name: "sdb1", path: "/mnt/b/sub"}}
+	if len(mounts) != len(want) {
+		t.Fatalf("findMountPoints() = %v, want %v", mounts, want)
+	}
+	for i := range want {
+		if mounts[i] != want[i] {
+			t.Errorf("findMountPoints()[%d] = %v, want %v", i, mounts[i], want[i])
+		}
+	}
+}
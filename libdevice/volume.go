@@ -0,0 +1,335 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: loop-backed volume operation for container
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	hconfig "isula.org/syscontainer-tools/config"
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/libdevice/nsexec"
+	"isula.org/syscontainer-tools/pkg/loop"
+	"isula.org/syscontainer-tools/types"
+	"isula.org/syscontainer-tools/utils"
+)
+
+// ParseVolume checks the volume options, exactly one of path and device should be specified.
+func ParseVolume(image, fsType, path, device, options string) (*hconfig.VolumeMapping, error) {
+	if image == "" || !filepath.IsAbs(image) {
+		return nil, fmt.Errorf("image should be an absolute path: %q", image)
+	}
+	if (path == "") == (device == "") {
+		return nil, fmt.Errorf("either --path or --device should be specified")
+	}
+	if path != "" && !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("path should be an absolute path: %s", path)
+	}
+	if device != "" && !filepath.IsAbs(device) {
+		return nil, fmt.Errorf("device should be an absolute path: %s", device)
+	}
+	if path != "" && fsType == "" {
+		return nil, fmt.Errorf("filesystem type should be specified to mount the volume")
+	}
+	v := &hconfig.VolumeMapping{
+		Image:   filepath.Clean(image),
+		FsType:  fsType,
+		Options: options,
+	}
+	if path != "" {
+		v.Path = filepath.Clean(path)
+	} else {
+		v.Device = filepath.Clean(device)
+	}
+	return v, nil
+}
+
+// volumeReadOnly checks if the volume is mounted read-only
+func volumeReadOnly(v *hconfig.VolumeMapping) bool {
+	for _, opt := range strings.Split(v.Options, ",") {
+		if opt == "ro" {
+			return true
+		}
+	}
+	return false
+}
+
+// VolumeMount returns the mount of filesystem in the volume, which is on the loop device.
+func VolumeMount(v *hconfig.VolumeMapping) *hconfig.MountMapping {
+	return &hconfig.MountMapping{
+		Source:      v.LoopDevice,
+		Destination: v.Path,
+		Type:        v.FsType,
+		Options:     v.Options,
+		Transfer:    true,
+	}
+}
+
+// prepareImage creates the sparse image file of size and formats it if it doesn't exist,
+// returns true if the image is created.
+func prepareImage(v *hconfig.VolumeMapping, size string) (bool, error) {
+	if _, err := os.Stat(v.Image); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	if size == "" {
+		return false, fmt.Errorf("image %s does not exist, --size should be specified to create it", v.Image)
+	}
+	bytes, err := parseSize(size)
+	if err != nil || bytes <= 0 {
+		return false, fmt.Errorf("invalid size: %s", size)
+	}
+
+	f, err := os.OpenFile(v.Image, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return false, err
+	}
+	err = f.Truncate(bytes)
+	f.Close()
+	if err == nil && v.FsType != "" {
+		if out, mkfsErr := exec.Command("mkfs", "-t", v.FsType, v.Image).CombinedOutput(); mkfsErr != nil {
+			err = fmt.Errorf("failed to format %s as %s: %v, %s", v.Image, v.FsType, mkfsErr, strings.TrimSpace(string(out)))
+		}
+	}
+	if err != nil {
+		os.Remove(v.Image)
+		return false, err
+	}
+	fmt.Fprintf(os.Stdout, "Create image (%s) of size %s done.\n", v.Image, size)
+	return true, nil
+}
+
+// AttachVolume attaches the image of volume to loop device, the loop device attached last time
+// is preferred, and registers the device to container if it's exposed to container.
+func AttachVolume(id string, v *hconfig.VolumeMapping) (string, error) {
+	device, err := loop.FindByImage(v.Image)
+	if err != nil {
+		return "", err
+	}
+	if device != "" && device != v.LoopDevice {
+		return "", fmt.Errorf("image %s is already attached to %s", v.Image, device)
+	}
+	if device == "" {
+		if device, err = loop.Attach(v.Image, v.LoopDevice, volumeReadOnly(v)); err != nil {
+			return "", err
+		}
+	}
+	if v.Device == "" {
+		return device, nil
+	}
+
+	dev, err := DeviceFromPath(device, "")
+	if err != nil {
+		loop.Detach(device)
+		return "", err
+	}
+	registry, err := openRegistry()
+	if err != nil {
+		loop.Detach(device)
+		return "", err
+	}
+	defer registry.close()
+	if err := registry.acquire(id, dev); err != nil {
+		loop.Detach(device)
+		return "", err
+	}
+	return device, nil
+}
+
+// DetachVolume releases the loop device of the volume, the filesystem mounted on host
+// through the transfer path is unmounted first.
+func DetachVolume(id string, v *hconfig.VolumeMapping) error {
+	if v.LoopDevice == "" {
+		return nil
+	}
+	if v.Path != "" {
+		if err := utils.RemoveTransferMount(id, v.Path); err != nil {
+			return err
+		}
+	}
+	if v.Device != "" {
+		if dev, err := DeviceFromPath(v.LoopDevice, ""); err == nil {
+			registry, err := openRegistry()
+			if err != nil {
+				return err
+			}
+			registry.release(id, dev)
+			if err := registry.close(); err != nil {
+				logrus.Errorf("Failed to save device registry: %v", err)
+			}
+		}
+	}
+	return loop.Detach(v.LoopDevice)
+}
+
+// updateVolumeConfig adds or removes the volume in container config
+func updateVolumeConfig(c *container.Container, v *hconfig.VolumeMapping, isAdd bool) error {
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return err
+	}
+	defer config.Flush()
+	return config.UpdateVolume(v, isAdd)
+}
+
+// AddVolume creates the image if needed, attaches it to a loop device, and exposes the
+// block device to container, or mounts the filesystem in container.
+func AddVolume(c *container.Container, v *hconfig.VolumeMapping, size string) (err error) {
+	driver := nsexec.NewDefaultNsDriver()
+	pid := strconv.Itoa(c.Pid())
+
+	// the image is a host path, check it before anything is created at the path.
+	if err := checkImagePolicy(c, v); err != nil {
+		return err
+	}
+	created, err := prepareImage(v, size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// the image created by this call is useless if failed to add it.
+		if err != nil && created {
+			if rErr := os.Remove(v.Image); rErr != nil {
+				logrus.Warnf("Failed to remove image %s: %v", v.Image, rErr)
+			}
+		}
+	}()
+	device, err := loop.FindByImage(v.Image)
+	if err != nil {
+		return err
+	}
+	if device != "" {
+		return fmt.Errorf("image %s is already attached to %s", v.Image, device)
+	}
+	if v.LoopDevice, err = loop.Attach(v.Image, "", volumeReadOnly(v)); err != nil {
+		return err
+	}
+
+	if v.Device != "" {
+		dev, err := ParseDevice(fmt.Sprintf("%s:%s:rwm", v.LoopDevice, v.Device))
+		if err == nil {
+			err = AddDevice(c, []*types.Device{dev}, &types.AddDeviceOptions{})
+		}
+		if err == nil {
+			if err = updateVolumeConfig(c, v, true); err != nil {
+				RemoveDevice(c, []*types.Device{dev}, &types.RemoveDeviceOptions{Force: true})
+			}
+		}
+		if err != nil {
+			loop.Detach(v.LoopDevice)
+			return err
+		}
+	} else {
+		if err := checkMountPolicy(c, VolumeMount(v), nil); err != nil {
+			loop.Detach(v.LoopDevice)
+			return err
+		}
+		if err := updateVolumeConfig(c, v, true); err != nil {
+			loop.Detach(v.LoopDevice)
+			return err
+		}
+		if c.Pid() > 0 && c.CheckPidExist() {
+			if err := MountInContainer(driver, c.GetSpec(), pid, "/", c.ContainerID(), VolumeMount(v)); err != nil {
+				updateVolumeConfig(c, v, false)
+				loop.Detach(v.LoopDevice)
+				return fmt.Errorf("failed to mount volume %s to %s in container: %v", v.Image, v.Path, err)
+			}
+		}
+	}
+	// loop device is attached again by prestart hook when container starts.
+	if !(c.Pid() > 0 && c.CheckPidExist()) {
+		if err := DetachVolume(c.ContainerID(), v); err != nil {
+			logrus.Warnf("Failed to detach volume %s from %s: %v", v.Image, v.LoopDevice, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "Add volume (%s) to container(%s,%s) by %s done.\n", v.Image, c.Name(), v, v.LoopDevice)
+	logrus.Infof("Add volume (%s) to container(%s,%s) by %s done", v.Image, c.Name(), v, v.LoopDevice)
+	return nil
+}
+
+// RemoveVolume removes the block device or unmounts the filesystem of the volume from container,
+// and detaches the loop device.
+func RemoveVolume(c *container.Container, image string, opts *types.RemoveDeviceOptions) error {
+	driver := nsexec.NewDefaultNsDriver()
+	pid := strconv.Itoa(c.Pid())
+	running := c.Pid() > 0 && c.CheckPidExist()
+
+	if err := c.Lock(); err != nil {
+		return err
+	}
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		c.Unlock()
+		return err
+	}
+	v := config.FindVolume(filepath.Clean(image))
+	c.Unlock()
+	if v == nil {
+		return fmt.Errorf("image %s is not attached to container", image)
+	}
+
+	if v.Device != "" {
+		dev, err := ParseDevice(fmt.Sprintf("%s:%s", v.LoopDevice, v.Device))
+		if err != nil {
+			return err
+		}
+		if err := RemoveDevice(c, []*types.Device{dev}, opts); err != nil {
+			return err
+		}
+	} else if running {
+		if err := driver.RemoveBind(pid, &types.Bind{ContainerPath: v.Path}); err != nil {
+			return fmt.Errorf("failed to unmount %s in container: %v", v.Path, err)
+		}
+	}
+	if err := updateVolumeConfig(c, v, false); err != nil {
+		return err
+	}
+	// loop device is released by poststop hook when container is stopped.
+	if running {
+		if err := DetachVolume(c.ContainerID(), v); err != nil {
+			logrus.Errorf("Failed to detach volume %s from %s: %v", v.Image, v.LoopDevice, err)
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "Remove volume (%s) from container(%s,%s) done.\n", v.Image, c.Name(), v)
+	logrus.Infof("Remove volume (%s) from container(%s,%s) done", v.Image, c.Name(), v)
+	return nil
+}
+
+// ListVolume lists the volumes attached to container
+func ListVolume(c *container.Container) ([]*hconfig.VolumeMapping, error) {
+	if err := c.Lock(); err != nil {
+		return nil, err
+	}
+	defer c.Unlock()
+
+	config, err := hconfig.NewContainerConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return config.GetVolumes(), nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: loop-backed volume tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hconfig "isula.org/syscontainer-tools/config"
+)
+
+func TestParseVolume(t *testing.T) {
+	tests := []struct {
+		image, fsType, path, device string
+		valid                       bool
+	}{
+		{"/data/vol.img", "ext4", "/data", "", true},
+		{"/data/vol.img", "", "", "/dev/vdz", true},
+		{"vol.img", "ext4", "/data", "", false},
+		// exactly one of path and device.
+		{"/data/vol.img", "ext4", "/data", "/dev/vdz", false},
+		{"/data/vol.img", "ext4", "", "", false},
+		{"/data/vol.img", "ext4", "data", "", false},
+		{"/data/vol.img", "", "", "vdz", false},
+		// filesystem type is required to mount.
+		{"/data/vol.img", "", "/data", "", false},
+	}
+	for _, tt := range tests {
+		v, err := ParseVolume(tt.image, tt.fsType, tt.path, tt.device, "")
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseVolume(%q, %q, %q, %q) error = %v, want valid %v", tt.image, tt.fsType, tt.path, tt.device, err, tt.valid)
+			continue
+		}
+		if err == nil && (v.Path != tt.path || v.Device != tt.device) {
+			t.Errorf("ParseVolume(%q, %q, %q, %q) = %+v", tt.image, tt.fsType, tt.path, tt.device, v)
+		}
+	}
+}
+
+func TestVolumeReadOnly(t *testing.T) {
+	if !volumeReadOnly(&hconfig.VolumeMapping{Options: "nosuid,ro"}) {
+		t.Errorf("volume with ro option should be read-only")
+	}
+	if volumeReadOnly(&hconfig.VolumeMapping{Options: "nosuid,rw"}) {
+		t.Errorf("volume with rw option should not be read-only")
+	}
+}
+
+func TestPrepareImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	v := &hconfig.VolumeMapping{Image: filepath.Join(dir, "vol.img")}
+
+	if _, err := prepareImage(v, ""); err == nil {
+		t.Errorf("prepareImage without size should fail if the image does not exist")
+	}
+	if _, err := prepareImage(v, "-1"); err == nil {
+		t.Errorf("prepareImage with invalid size should fail")
+	}
+	created, err := prepareImage(v, "1m")
+	if err != nil || !created {
+		t.Fatalf("prepareImage() = %v, %v, want created", created, err)
+	}
+	if fi, err := os.Stat(v.Image); err != nil || fi.Size() != 1024*1024 {
+		t.Errorf("image should be created with size 1m, stat: %v, %v", fi, err)
+	}
+	// the existing image is used as is.
+	if created, err := prepareImage(v, "2m"); err != nil || created {
+		t.Errorf("prepareImage() of existing image = %v, %v, want not created", created, err)
+	}
+}
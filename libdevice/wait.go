@@ -0,0 +1,116 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: wait for host device
+// Author: zhangwei
+// Create: 2018-01-18
+
+package libdevice
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// recheck the node periodically, the link may appear before its target.
+	waitRecheckInterval = 500 * time.Millisecond
+	udevdControlSocket  = "/run/udev/control"
+)
+
+// WaitDevice waits for the device node on host to appear and udev to settle.
+// It returns error if the node does not appear in timeout.
+func WaitDevice(path string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if err := waitDeviceNode(path, deadline); err != nil {
+		return err
+	}
+	settleUdev(deadline)
+	return nil
+}
+
+// nearestDir returns the nearest existing dir of path, eg: /dev/mapper may not exist yet.
+func nearestDir(path string) string {
+	dir := filepath.Dir(path)
+	for dir != "/" {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+func waitDeviceNode(path string, deadline time.Time) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed to init inotify: %v", err)
+	}
+	defer unix.Close(fd)
+
+	watched := make(map[string]bool)
+	buf := make([]byte, unix.SizeofInotifyEvent*64+unix.PathMax)
+	for {
+		if _, err := DeviceFromPath(path, ""); err == nil {
+			return nil
+		}
+		remain := deadline.Sub(time.Now())
+		if remain <= 0 {
+			return fmt.Errorf("device %s does not appear in time", path)
+		}
+
+		dir := nearestDir(path)
+		if !watched[dir] {
+			if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CREATE|unix.IN_MOVED_TO|unix.IN_ATTRIB); err != nil {
+				return fmt.Errorf("failed to watch %s: %v", dir, err)
+			}
+			watched[dir] = true
+		}
+
+		if remain > waitRecheckInterval {
+			remain = waitRecheckInterval
+		}
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		if _, err := unix.Poll(fds, int(remain/time.Millisecond)+1); err != nil && err != unix.EINTR {
+			return err
+		}
+		// drain the events, we only care about the node itself.
+		for {
+			if _, err := unix.Read(fd, buf); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// settleUdev waits for udevd to finish processing the events, so links and
+// permissions of the device are ready.
+func settleUdev(deadline time.Time) {
+	if _, err := os.Stat(udevdControlSocket); err != nil {
+		return
+	}
+	udevadm, err := exec.LookPath("udevadm")
+	if err != nil {
+		return
+	}
+	seconds := int(deadline.Sub(time.Now()) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	if out, err := exec.Command(udevadm, "settle", "--timeout="+strconv.Itoa(seconds)).CombinedOutput(); err != nil {
+		logrus.Warnf("udevadm settle failed: %s, %v", string(out), err)
+	}
+}
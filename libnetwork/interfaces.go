@@ -19,9 +19,12 @@ import (
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 	hconfig "isula.org/syscontainer-tools/config"
 	"isula.org/syscontainer-tools/container"
 	"isula.org/syscontainer-tools/libnetwork/drivers"
+	"isula.org/syscontainer-tools/libnetwork/nsutils"
 	"isula.org/syscontainer-tools/types"
 )
 
@@ -162,6 +165,39 @@ func DelNicFromContainer(nsPath string, config *types.InterfaceConf) error {
 	return driver.DeleteIf()
 }
 
+// ReleaseNetns removes the veths in network namespace pinned at nsPath, the host side ones
+// are removed along with them, then unpins the network namespace.
+// With dryRun, the veths are only listed.
+func ReleaseNetns(nsPath string, dryRun bool) ([]string, error) {
+	var veths []string
+	err := nsutils.NsInvoke(nsPath, func(nsFD int) error { return nil }, func(callerFD int) error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if link.Type() != "veth" {
+				continue
+			}
+			veths = append(veths, link.Attrs().Name)
+			if dryRun {
+				continue
+			}
+			if err := netlink.LinkDel(link); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", link.Attrs().Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil || dryRun {
+		return veths, err
+	}
+	if err := unix.Unmount(nsPath, unix.MNT_DETACH); err != nil && err != unix.EINVAL {
+		return veths, err
+	}
+	return veths, os.Remove(nsPath)
+}
+
 // UpdateNic will reconfigure network interface for a container
 func UpdateNic(ctr *container.Container, config *types.InterfaceConf, updateConfigOnly bool) error {
 	if err := ctr.Lock(); err != nil {
@@ -89,20 +89,35 @@ func mainWork() {
 
 	app.Commands = []cli.Command{
 		addDevCommand,
+		addDevRuleCommand,
+		addMountCommand,
 		addNicCommand,
 		addPathCommand,
 		addRouteCommand,
+		addVolumeCommand,
 		relabelCommand,
 		rmDevCommand,
+		moveDevCommand,
+		rmDevRuleCommand,
+		rmMountCommand,
 		rmNicCommand,
 		rmPathCommand,
 		rmRouteCommand,
+		rmVolumeCommand,
+		listMountCommand,
 		listNicCommand,
 		listPathCommand,
 		listRouteCommand,
+		listVolumeCommand,
 		listDevCommand,
+		listDevRuleCommand,
+		devStatsCommand,
 		updateDevCommand,
 		updateNicCommand,
+		updatePathCommand,
+		watchCommand,
+		inventoryCommand,
+		gcCommand,
 	}
 
 	app.CommandNotFound = func(context *cli.Context, command string) {
@@ -0,0 +1,154 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: filesystem mount commands
+// Author: zhangwei
+// Create: 2018-01-18
+
+// go base main package
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/libdevice"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var addMountCommand = cli.Command{
+	Name:      "add-mount",
+	Usage:     "mount a filesystem to container",
+	ArgsUsage: `<container_id> <source> <destination>`,
+	Description: `You can mount a filesystem(eg: tmpfs, hugetlbfs, or ext4 on a host block device) to container.
+The filesystem on block device is mounted on host and propagated to container, others are mounted
+in container directly, source could be any name(eg: "tmpfs") for them.
+The mounts are kept after container restarts, example:
+	syscontainer-tools add-mount --type tmpfs --options size=64m,mode=1777 <container_id> tmpfs /tmp/cache
+	syscontainer-tools add-mount --type ext4 <container_id> /dev/sdc1 /data`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "type, t",
+			Usage: "Filesystem type to mount",
+		},
+		cli.StringFlag{
+			Name:  "options, o",
+			Usage: "Comma separated mount options, eg: ro,size=64m",
+		},
+		cli.BoolFlag{
+			Name:  "force-unsafe",
+			Usage: "Mount the filesystem even if the block device is in use on host",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() != 3 {
+			fatalf("%s: %q requires exactly 3 args", os.Args[0], context.Command.Name)
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		m, device, err := libdevice.ParseMount(context.String("type"), context.Args()[1], context.Args()[2], context.String("options"))
+		if err != nil {
+			fatal(err)
+		}
+
+		if err := libdevice.AddMount(c, m, device, context.Bool("force-unsafe")); err != nil {
+			fatalf("Failed to add mount: %v", err)
+		}
+		logrus.Infof("add mount to container %q successfully", name)
+	},
+}
+
+var rmMountCommand = cli.Command{
+	Name:        "remove-mount",
+	Usage:       "unmount one or more filesystems added by add-mount from container",
+	ArgsUsage:   `<container_id> <destination> [<destination> ...]`,
+	Description: `You can unmount multiple filesystems added by add-mount from container.`,
+	Flags:       []cli.Flag{},
+	Action: func(context *cli.Context) {
+		if context.NArg() < 2 {
+			fatalf("%s: %q requires a minimum of 2 args", os.Args[0], context.Command.Name)
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		for _, destination := range context.Args()[1:] {
+			if err := libdevice.RemoveMount(c, destination); err != nil {
+				fatalf("Failed to remove mount: %v", err)
+			}
+		}
+		logrus.Infof("remove mount from container %q successfully", name)
+	},
+}
+
+var listMountCommand = cli.Command{
+	Name:      "list-mount",
+	Usage:     "list all filesystems mounted to container by add-mount",
+	ArgsUsage: `<container_id>`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "pretty, p",
+			Usage: "If this flag is set, list mounts in pretty json form",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() < 1 {
+			fatalf("%s: %q must accept a container-id", os.Args[0], context.Command.Name)
+		}
+		if context.NArg() > 1 {
+			fatalf("Don't put container-id in the middle of options")
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		mounts, err := libdevice.ListMount(c)
+		if err != nil {
+			fatalf("Failed to list mount in container: %v", err)
+		}
+		if len(mounts) == 0 {
+			logrus.Infof("list mount in container %q successfully", name)
+			return
+		}
+
+		mountsData, err := json.Marshal(mounts)
+		if err != nil {
+			fatalf("failed to Marshal mount config: %v", err)
+		}
+		// the buffer must not share memory with the data, it's overwritten by indent.
+		mountsBuffer := new(bytes.Buffer)
+		if !context.Bool("pretty") {
+			mountsBuffer.Write(mountsData)
+		} else {
+			if err := json.Indent(mountsBuffer, mountsData, "", "\t"); err != nil {
+				fatalf("failed to Indent mount data: %v", err)
+			}
+		}
+		mountsBuffer.WriteString("\n")
+		if _, err := os.Stdout.Write(mountsBuffer.Bytes()); err != nil {
+			logrus.Errorf("Write mountsBuffer error %v", err)
+		}
+		logrus.Infof("list mount in container %q successfully", name)
+	},
+}
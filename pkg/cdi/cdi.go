@@ -0,0 +1,213 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: Container Device Interface(CDI) spec parsing
+// Author: zhangwei
+// Create: 2018-01-18
+
+package cdi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// SpecDirs are the directories of CDI specs, specs in later ones override the earlier ones.
+var SpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// Spec is a CDI spec file, which describes the devices of a kind.
+type Spec struct {
+	Version        string         `json:"cdiVersion"`
+	Kind           string         `json:"kind"`
+	Devices        []Device       `json:"devices"`
+	ContainerEdits ContainerEdits `json:"containerEdits,omitempty"`
+}
+
+// Device is a named device in CDI spec.
+type Device struct {
+	Name           string         `json:"name"`
+	ContainerEdits ContainerEdits `json:"containerEdits"`
+}
+
+// ContainerEdits are the changes to make to container for the device.
+type ContainerEdits struct {
+	Env         []string      `json:"env,omitempty"`
+	DeviceNodes []*DeviceNode `json:"deviceNodes,omitempty"`
+	Hooks       []*Hook       `json:"hooks,omitempty"`
+	Mounts      []*Mount      `json:"mounts,omitempty"`
+}
+
+// DeviceNode is a device node to create in container.
+type DeviceNode struct {
+	Path        string  `json:"path"`
+	HostPath    string  `json:"hostPath,omitempty"`
+	Type        string  `json:"type,omitempty"`
+	Major       int64   `json:"major,omitempty"`
+	Minor       int64   `json:"minor,omitempty"`
+	FileMode    *uint32 `json:"fileMode,omitempty"`
+	Permissions string  `json:"permissions,omitempty"`
+	UID         *uint32 `json:"uid,omitempty"`
+	GID         *uint32 `json:"gid,omitempty"`
+}
+
+// Mount is a mount to add to container.
+type Mount struct {
+	HostPath      string   `json:"hostPath"`
+	ContainerPath string   `json:"containerPath"`
+	Options       []string `json:"options,omitempty"`
+	Type          string   `json:"type,omitempty"`
+}
+
+// Hook is an OCI hook to run for the device.
+type Hook struct {
+	HookName string   `json:"hookName"`
+	Path     string   `json:"path"`
+	Args     []string `json:"args,omitempty"`
+	Env      []string `json:"env,omitempty"`
+	Timeout  *int     `json:"timeout,omitempty"`
+}
+
+// ParseQualifiedName splits the fully qualified device name "vendor.com/class=name" into kind and name.
+func ParseQualifiedName(device string) (string, string, error) {
+	arr := strings.SplitN(device, "=", 2)
+	if len(arr) != 2 || arr[1] == "" {
+		return "", "", fmt.Errorf("invalid CDI device name %q, should be vendor.com/class=name", device)
+	}
+	kind := strings.SplitN(arr[0], "/", 2)
+	if len(kind) != 2 || kind[0] == "" || kind[1] == "" {
+		return "", "", fmt.Errorf("invalid CDI device name %q, should be vendor.com/class=name", device)
+	}
+	return arr[0], arr[1], nil
+}
+
+// loadSpec reads the CDI spec file in json or yaml format.
+func loadSpec(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to parse CDI spec %s: %v", path, err)
+		}
+	}
+	spec := &Spec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("failed to parse CDI spec %s: %v", path, err)
+	}
+	return spec, nil
+}
+
+// yamlToJSON converts yaml document to json, so the spec is decoded by the same json tags.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	doc, err := jsonValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// jsonValue converts the maps decoded by yaml, which are keyed by interface{}, to string keyed ones.
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("non-string key %v", k)
+			}
+			jv, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = jv
+		}
+		return m, nil
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, val := range v {
+			jv, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = jv
+		}
+		return arr, nil
+	}
+	return v, nil
+}
+
+// specFiles returns the spec files in dir in lexical order.
+func specFiles(dir string) []string {
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			continue
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Resolve finds the device in CDI specs, returns the edits of the device
+// along with the spec-wide ones.
+func Resolve(device string) (*ContainerEdits, error) {
+	kind, name, err := ParseQualifiedName(device)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *ContainerEdits
+	for _, dir := range SpecDirs {
+		for _, file := range specFiles(dir) {
+			spec, err := loadSpec(file)
+			if err != nil {
+				logrus.Warnf("%v", err)
+				continue
+			}
+			if spec.Kind != kind {
+				continue
+			}
+			for _, dev := range spec.Devices {
+				if dev.Name != name {
+					continue
+				}
+				edits := &ContainerEdits{}
+				edits.append(&spec.ContainerEdits)
+				edits.append(&dev.ContainerEdits)
+				found = edits
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("CDI device %s is not found in %s", device, strings.Join(SpecDirs, ", "))
+	}
+	return found, nil
+}
+
+func (e *ContainerEdits) append(o *ContainerEdits) {
+	e.Env = append(e.Env, o.Env...)
+	e.DeviceNodes = append(e.DeviceNodes, o.DeviceNodes...)
+	e.Hooks = append(e.Hooks, o.Hooks...)
+	e.Mounts = append(e.Mounts, o.Mounts...)
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: CDI spec parsing tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package cdi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseQualifiedName(t *testing.T) {
+	tests := []struct {
+		device string
+		kind   string
+		name   string
+		valid  bool
+	}{
+		{"vendor.com/gpu=gpu0", "vendor.com/gpu", "gpu0", true},
+		{"vendor.com/gpu=all=1", "vendor.com/gpu", "all=1", true},
+		{"vendor.com/gpu", "", "", false},
+		{"vendor.com/gpu=", "", "", false},
+		{"gpu=gpu0", "", "", false},
+		{"/gpu=gpu0", "", "", false},
+		{"vendor.com/=gpu0", "", "", false},
+	}
+	for _, tt := range tests {
+		kind, name, err := ParseQualifiedName(tt.device)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseQualifiedName(%s) error = %v, want valid %v", tt.device, err, tt.valid)
+			continue
+		}
+		if kind != tt.kind || name != tt.name {
+			t.Errorf("ParseQualifiedName(%s) = %s, %s, want %s, %s", tt.device, kind, name, tt.kind, tt.name)
+		}
+	}
+}
+
+func writeSpec(t *testing.T, dir, file, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupSpecDirs(t *testing.T) (string, string, func()) {
+	etc, err := ioutil.TempDir("", "cdi-etc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := ioutil.TempDir("", "cdi-run")
+	if err != nil {
+		os.RemoveAll(etc)
+		t.Fatal(err)
+	}
+	saved := SpecDirs
+	SpecDirs = []string{etc, run}
+	return etc, run, func() {
+		SpecDirs = saved
+		os.RemoveAll(etc)
+		os.RemoveAll(run)
+	}
+}
+
+const gpuSpec = `{
+	"cdiVersion": "0.5.0",
+	"kind": "vendor.com/gpu",
+	"devices": [
+		{"name": "gpu0", "containerEdits": {"deviceNodes": [{"path": "/dev/gpu0"}]}},
+		{"name": "gpu1", "containerEdits": {"deviceNodes": [{"path": "/dev/gpu1"}]}}
+	],
+	"containerEdits": {"mounts": [{"hostPath": "/usr/lib/gpu", "containerPath": "/usr/lib/gpu"}]}
+}`
+
+func TestResolve(t *testing.T) {
+	etc, run, cleanup := setupSpecDirs(t)
+	defer cleanup()
+
+	writeSpec(t, etc, "gpu.json", gpuSpec)
+	writeSpec(t, etc, "broken.json", "{")
+	edits, err := Resolve("vendor.com/gpu=gpu1")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(edits.DeviceNodes) != 1 || edits.DeviceNodes[0].Path != "/dev/gpu1" {
+		t.Errorf("device nodes of gpu1 = %+v", edits.DeviceNodes)
+	}
+	// spec-wide edits are applied to all devices.
+	if len(edits.Mounts) != 1 || edits.Mounts[0].HostPath != "/usr/lib/gpu" {
+		t.Errorf("mounts of gpu1 = %+v", edits.Mounts)
+	}
+
+	// specs in later dirs override the earlier ones.
+	writeSpec(t, run, "gpu.json", `{"cdiVersion": "0.5.0", "kind": "vendor.com/gpu",
+		"devices": [{"name": "gpu1", "containerEdits": {"deviceNodes": [{"path": "/dev/gpu9"}]}}]}`)
+	edits, err = Resolve("vendor.com/gpu=gpu1")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(edits.DeviceNodes) != 1 || edits.DeviceNodes[0].Path != "/dev/gpu9" || len(edits.Mounts) != 0 {
+		t.Errorf("edits of gpu1 = %+v, should be overridden by %s", edits, run)
+	}
+
+	if _, err := Resolve("vendor.com/gpu=gpu2"); err == nil {
+		t.Errorf("Resolve should fail for the device not in specs")
+	}
+	if _, err := Resolve("vendor.com/nic=gpu0"); err == nil {
+		t.Errorf("Resolve should fail for the kind not in specs")
+	}
+	if _, err := Resolve("gpu0"); err == nil {
+		t.Errorf("Resolve should fail for the invalid name")
+	}
+}
+
+func TestResolveYamlSpec(t *testing.T) {
+	etc, _, cleanup := setupSpecDirs(t)
+	defer cleanup()
+
+	writeSpec(t, etc, "gpu.json", gpuSpec)
+	writeSpec(t, etc, "nic.yaml", `cdiVersion: 0.5.0
+kind: vendor.com/nic
+devices:
+- name: nic0
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nic0
+      type: c
+      major: 240
+      minor: 0
+      fileMode: 0660
+    mounts:
+    - hostPath: /usr/lib/nic
+      containerPath: /usr/lib/nic
+      options: [ro, bind]
+`)
+	edits, err := Resolve("vendor.com/nic=nic0")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(edits.DeviceNodes) != 1 {
+		t.Fatalf("device nodes of nic0 = %+v", edits.DeviceNodes)
+	}
+	node := edits.DeviceNodes[0]
+	if node.Path != "/dev/nic0" || node.Type != "c" || node.Major != 240 || node.FileMode == nil || *node.FileMode != 0660 {
+		t.Errorf("device node of nic0 = %+v", node)
+	}
+	if len(edits.Mounts) != 1 || edits.Mounts[0].ContainerPath != "/usr/lib/nic" || len(edits.Mounts[0].Options) != 2 {
+		t.Errorf("mounts of nic0 = %+v", edits.Mounts)
+	}
+
+	// the json specs are still resolved along with yaml ones.
+	if _, err := Resolve("vendor.com/gpu=gpu0"); err != nil {
+		t.Errorf("Resolve gpu0 failed: %v", err)
+	}
+
+	writeSpec(t, etc, "broken.yml", "kind: [")
+	if _, err := Resolve("vendor.com/nic=nic0"); err != nil {
+		t.Errorf("broken spec should be skipped: %v", err)
+	}
+}
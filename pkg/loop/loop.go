@@ -0,0 +1,171 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: loop device attach and detach
+// Author: zhangwei
+// Create: 2018-01-18
+
+package loop
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	loopControl = "/dev/loop-control"
+	// loopConfigure is LOOP_CONFIGURE since linux 5.8, which sets fd and status at once.
+	loopConfigure = 0x4C0A
+	// loFlagsReadOnly is LO_FLAGS_READ_ONLY
+	loFlagsReadOnly = 1
+	// maxRetry is the times to retry when the free loop device is taken by others.
+	maxRetry = 10
+)
+
+// loopConfig is struct loop_config of LOOP_CONFIGURE
+type loopConfig struct {
+	Fd        uint32
+	BlockSize uint32
+	Info      unix.LoopInfo64
+	Reserved  [8]uint64
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// getFree returns a free loop device, allocated by loop-control.
+func getFree() (string, error) {
+	ctrl, err := os.OpenFile(loopControl, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer ctrl.Close()
+	index, _, errno := unix.Syscall(unix.SYS_IOCTL, ctrl.Fd(), unix.LOOP_CTL_GET_FREE, 0)
+	if errno != 0 {
+		return "", fmt.Errorf("failed to get free loop device: %v", errno)
+	}
+	return fmt.Sprintf("/dev/loop%d", index), nil
+}
+
+// setup attaches image to the loop device, LOOP_SET_FD and LOOP_SET_STATUS64
+// are used on kernels without LOOP_CONFIGURE.
+func setup(loopFile, imageFile *os.File, info *unix.LoopInfo64) error {
+	config := &loopConfig{
+		Fd:   uint32(imageFile.Fd()),
+		Info: *info,
+	}
+	err := ioctl(loopFile.Fd(), loopConfigure, uintptr(unsafe.Pointer(config)))
+	if err != unix.EINVAL && err != unix.ENOTTY {
+		return err
+	}
+
+	if err := ioctl(loopFile.Fd(), unix.LOOP_SET_FD, imageFile.Fd()); err != nil {
+		return err
+	}
+	if err := ioctl(loopFile.Fd(), unix.LOOP_SET_STATUS64, uintptr(unsafe.Pointer(info))); err != nil {
+		ioctl(loopFile.Fd(), unix.LOOP_CLR_FD, 0)
+		return err
+	}
+	return nil
+}
+
+// Attach attaches image to a free loop device, and returns the path of the loop device.
+// prefer is tried first if it's not empty, so the device number is kept across container restarts.
+func Attach(image, prefer string, readOnly bool) (string, error) {
+	flag := os.O_RDWR
+	info := &unix.LoopInfo64{}
+	if readOnly {
+		flag = os.O_RDONLY
+		info.Flags = loFlagsReadOnly
+	}
+	copy(info.File_name[:], image)
+
+	imageFile, err := os.OpenFile(image, flag, 0)
+	if err != nil {
+		return "", err
+	}
+	defer imageFile.Close()
+
+	attach := func(device string) error {
+		loopFile, err := os.OpenFile(device, flag, 0)
+		if err != nil {
+			return err
+		}
+		defer loopFile.Close()
+		return setup(loopFile, imageFile, info)
+	}
+
+	if prefer != "" {
+		if err := attach(prefer); err == nil {
+			return prefer, nil
+		}
+	}
+	for i := 0; i < maxRetry; i++ {
+		device, err := getFree()
+		if err != nil {
+			return "", err
+		}
+		err = attach(device)
+		if err == unix.EBUSY {
+			// taken by others between getting and setting it up.
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to attach %s to %s: %v", image, device, err)
+		}
+		return device, nil
+	}
+	return "", fmt.Errorf("failed to attach %s: no free loop device", image)
+}
+
+// Detach detaches the image from the loop device
+func Detach(device string) error {
+	loopFile, err := os.OpenFile(device, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer loopFile.Close()
+	if err := ioctl(loopFile.Fd(), unix.LOOP_CLR_FD, 0); err != nil && err != unix.ENXIO {
+		return fmt.Errorf("failed to detach %s: %v", device, err)
+	}
+	return nil
+}
+
+// FindByImage returns the loop device which image is attached to, empty if not found.
+func FindByImage(image string) (string, error) {
+	image, err := filepath.EvalSymlinks(image)
+	if err != nil {
+		return "", err
+	}
+	files, err := filepath.Glob("/sys/block/loop*/loop/backing_file")
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(data)) == image {
+			name := filepath.Base(filepath.Dir(filepath.Dir(file)))
+			return filepath.Join("/dev", name), nil
+		}
+	}
+	return "", nil
+}
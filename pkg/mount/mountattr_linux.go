@@ -0,0 +1,111 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: mount_setattr of the new mount api
+// Author: zhangwei
+// Create: 2018-01-18
+
+package mount
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// the new mount api is not in vendored x/sys, the syscall number is the same on all architectures.
+const sysMountSetattr = 442
+
+const (
+	// AttrRdonly is MOUNT_ATTR_RDONLY
+	AttrRdonly = 0x1
+	// AttrIdmap is MOUNT_ATTR_IDMAP
+	AttrIdmap = 0x100000
+	// AtRecursive is AT_RECURSIVE, applies mount_setattr to the whole mount tree.
+	AtRecursive = 0x8000
+
+	attrNosuid      = 0x2
+	attrNodev       = 0x4
+	attrNoexec      = 0x8
+	attrAtimeMask   = 0x70
+	attrRelatime    = 0x0
+	attrNoatime     = 0x10
+	attrStrictatime = 0x20
+	attrNodiratime  = 0x80
+)
+
+// Attr is struct mount_attr of mount_setattr
+type Attr struct {
+	AttrSet     uint64
+	AttrClr     uint64
+	Propagation uint64
+	UsernsFd    uint64
+}
+
+// SetattrSupported checks if the kernel supports mount_setattr(linux 5.12),
+// it returns ENOSYS on old kernels, and EBADF for the invalid fd here.
+func SetattrSupported() bool {
+	_, _, errno := unix.Syscall6(sysMountSetattr, ^uintptr(0), 0, 0, 0, 0, 0)
+	return errno != unix.ENOSYS
+}
+
+// Setattr changes the attributes of the mount at path relative to dirfd
+func Setattr(dirfd int, path string, flags int, attr *Attr) error {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := unix.Syscall6(sysMountSetattr, uintptr(dirfd), uintptr(unsafe.Pointer(p)), uintptr(flags),
+		uintptr(unsafe.Pointer(attr)), unsafe.Sizeof(*attr), 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// AttrFromFlags converts the per-mount flags of mount(2) to mount attributes
+func AttrFromFlags(flag uintptr) *Attr {
+	attr := &Attr{}
+	for msFlag, attrFlag := range map[uintptr]uint64{
+		syscall.MS_RDONLY:     AttrRdonly,
+		syscall.MS_NOSUID:     attrNosuid,
+		syscall.MS_NODEV:      attrNodev,
+		syscall.MS_NOEXEC:     attrNoexec,
+		syscall.MS_NODIRATIME: attrNodiratime,
+	} {
+		if flag&msFlag != 0 {
+			attr.AttrSet |= attrFlag
+		}
+	}
+	// atime is one of relatime, noatime and strictatime, it's changed only if specified.
+	switch {
+	case flag&syscall.MS_NOATIME != 0:
+		attr.AttrSet |= attrNoatime
+		attr.AttrClr |= attrAtimeMask
+	case flag&syscall.MS_STRICTATIME != 0:
+		attr.AttrSet |= attrStrictatime
+		attr.AttrClr |= attrAtimeMask
+	case flag&syscall.MS_RELATIME != 0:
+		attr.AttrSet |= attrRelatime
+		attr.AttrClr |= attrAtimeMask
+	}
+	return attr
+}
+
+// setRecursiveReadonly makes the mount at target and all mounts under it read-only
+func setRecursiveReadonly(target string) error {
+	if !SetattrSupported() {
+		return fmt.Errorf("recursive read-only is not supported by kernel, linux 5.12 is required")
+	}
+	if err := Setattr(unix.AT_FDCWD, target, AtRecursive, &Attr{AttrSet: AttrRdonly}); err != nil {
+		return fmt.Errorf("failed to make %s recursive read-only: %v", target, err)
+	}
+	return nil
+}
@@ -22,27 +22,157 @@ import (
 	docker_mount "github.com/docker/docker/pkg/mount"
 )
 
+const (
+	propagationFlags = uintptr(syscall.MS_SLAVE | syscall.MS_SHARED | syscall.MS_UNBINDABLE | syscall.MS_PRIVATE)
+	// perMountFlags are ignored when bind mounting, they take effect by remounting.
+	perMountFlags = uintptr(syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME | syscall.MS_STRICTATIME)
+	// RecursiveReadonly is the option making the mount and all its submounts read-only.
+	RecursiveReadonly = "rro"
+)
+
+var propagationOptions = map[string]uintptr{
+	"private":     syscall.MS_PRIVATE,
+	"rprivate":    syscall.MS_PRIVATE | syscall.MS_REC,
+	"slave":       syscall.MS_SLAVE,
+	"rslave":      syscall.MS_SLAVE | syscall.MS_REC,
+	"shared":      syscall.MS_SHARED,
+	"rshared":     syscall.MS_SHARED | syscall.MS_REC,
+	"unbindable":  syscall.MS_UNBINDABLE,
+	"runbindable": syscall.MS_UNBINDABLE | syscall.MS_REC,
+}
+
+// clearOptions are the options clearing per-mount flags
+var clearOptions = map[string]uintptr{
+	"suid":     syscall.MS_NOSUID,
+	"dev":      syscall.MS_NODEV,
+	"exec":     syscall.MS_NOEXEC,
+	"atime":    syscall.MS_NOATIME,
+	"diratime": syscall.MS_NODIRATIME,
+}
+
+// mountOptions is the parsed options of mount
+type mountOptions struct {
+	flag        uintptr
+	data        string
+	propagation uintptr
+	recursiveRO bool
+	// cleared are the per-mount flags cleared explicitly.
+	cleared uintptr
+}
+
+// parseMountOptions parses options, the propagation is kept apart, as MS_REC of rbind
+// doesn't make the propagation recursive.
+func parseMountOptions(options string) *mountOptions {
+	opts := &mountOptions{}
+	var rest []string
+	for _, opt := range strings.Split(options, ",") {
+		if propagation, ok := propagationOptions[opt]; ok {
+			opts.propagation = propagation
+			continue
+		}
+		if clear, ok := clearOptions[opt]; ok {
+			opts.cleared |= clear
+		}
+		if opt == RecursiveReadonly {
+			opts.recursiveRO = true
+			opt = "ro"
+		}
+		rest = append(rest, opt)
+	}
+	flag, data := docker_mount.ParseOptions(strings.Join(rest, ","))
+	opts.flag = uintptr(flag)
+	opts.data = data
+	return opts
+}
+
 // Mount is mount operation
 func Mount(device, target, mType, options string) error {
-	flagint, data := docker_mount.ParseOptions(options)
-	flag := uintptr(flagint)
-	// propagation option
-	propagationFlags := (uintptr)(syscall.MS_SLAVE | syscall.MS_SHARED | syscall.MS_UNBINDABLE | syscall.MS_PRIVATE)
-
-	if err := syscall.Mount(device, target, mType, flag&^propagationFlags, data); err != nil {
+	opts := parseMountOptions(options)
+	if err := syscall.Mount(device, target, mType, opts.flag, opts.data); err != nil {
 		return err
 	}
+	if err := setMountFlags(target, opts); err != nil {
+		syscall.Unmount(target, syscall.MNT_DETACH)
+		return err
+	}
+	return nil
+}
+
+// SetMountFlags applies the per-mount flags of bind, recursive read-only and propagation
+// in options to the mount at target.
+func SetMountFlags(target, options string) error {
+	return setMountFlags(target, parseMountOptions(options))
+}
 
-	// If we have a bind mount or remount, remount...
-	if flag&syscall.MS_BIND == syscall.MS_BIND && flag&syscall.MS_RDONLY == syscall.MS_RDONLY {
-		return syscall.Mount(device, target, mType, flag|syscall.MS_REMOUNT, data)
+func setMountFlags(target string, opts *mountOptions) error {
+	// If we have a bind mount, remount to apply per-mount flags, it changes the top mount only.
+	if opts.flag&syscall.MS_BIND == syscall.MS_BIND && opts.flag&perMountFlags != 0 {
+		if err := syscall.Mount("", target, "", opts.flag&perMountFlags|syscall.MS_BIND|syscall.MS_REMOUNT, ""); err != nil {
+			return err
+		}
 	}
-	if flag&propagationFlags != 0 {
-		return syscall.Mount("none", target, "none", flag&propagationFlags, data)
+	if opts.recursiveRO {
+		if err := setRecursiveReadonly(target); err != nil {
+			return err
+		}
+	}
+	if opts.propagation != 0 {
+		return syscall.Mount("none", target, "none", opts.propagation, "")
 	}
 	return nil
 }
 
+// remountKeepFlags are the per-mount flags kept when remounting a bind unless the new options
+// clear them explicitly, some of them are locked in user namespace and the remount fails if they are cleared.
+var remountKeepFlags = map[int64]uintptr{
+	// ST_NOSUID, ST_NODEV, ST_NOEXEC, ST_NOATIME, ST_NODIRATIME, ST_RELATIME
+	0x2:    syscall.MS_NOSUID,
+	0x4:    syscall.MS_NODEV,
+	0x8:    syscall.MS_NOEXEC,
+	0x400:  syscall.MS_NOATIME,
+	0x800:  syscall.MS_NODIRATIME,
+	0x1000: syscall.MS_RELATIME,
+}
+
+// RemountBind changes the per-mount flags, recursive read-only and propagation of the bind mount
+// at target to options, the nosuid, nodev, noexec and atime flags are kept unless options clear them explicitly.
+func RemountBind(target, options string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(target, &st); err != nil {
+		return err
+	}
+	var keep uintptr
+	for stFlag, msFlag := range remountKeepFlags {
+		if st.Flags&stFlag != 0 {
+			keep |= msFlag
+		}
+	}
+
+	opts := parseMountOptions(options)
+	keep &^= opts.cleared
+	// atime flags are exclusive, the kept one is replaced by the new one.
+	atimeFlags := uintptr(syscall.MS_NOATIME | syscall.MS_RELATIME | syscall.MS_STRICTATIME)
+	if opts.flag&atimeFlags != 0 {
+		keep &^= atimeFlags
+	}
+	if err := syscall.Mount("", target, "", opts.flag&perMountFlags|keep|syscall.MS_BIND|syscall.MS_REMOUNT, ""); err != nil {
+		return err
+	}
+	opts.flag &^= syscall.MS_BIND
+	return setMountFlags(target, opts)
+}
+
+// IsRecursiveReadonly checks if options make the submounts read-only too
+func IsRecursiveReadonly(options string) bool {
+	return parseMountOptions(options).recursiveRO
+}
+
+// IsRecursiveBind checks if options bind mount the submounts too
+func IsRecursiveBind(options string) bool {
+	return parseMountOptions(options).flag&(syscall.MS_BIND|syscall.MS_REC) == syscall.MS_BIND|syscall.MS_REC
+}
+
 // Unmount is unmount operation
 func Unmount(target string) error {
 	return syscall.Unmount(target, syscall.MNT_DETACH)
@@ -53,10 +183,10 @@ func ValidMountPropagation(path, mOpt string) error {
 	var bind, slave, shared bool
 	var slavemnt, sharedmnt bool
 	for _, opt := range strings.Split(mOpt, ",") {
-		if opt == "bind" {
+		if opt == "bind" || opt == "rbind" {
 			bind = true
 		}
-		if opt == "shared" {
+		if opt == "shared" || opt == "rshared" {
 			shared = true
 		}
 		if opt == "slave" {
@@ -0,0 +1,369 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: administrator policy of devices and paths
+// Author: zhangwei
+// Create: 2018-01-18
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"isula.org/syscontainer-tools/types"
+)
+
+const (
+	// DefaultPolicyFile is the policy file path, no policy is enforced if it does not exist.
+	DefaultPolicyFile = "/etc/syscontainer-tools/policy.json"
+
+	// ActionAllow allows the operation
+	ActionAllow = "allow"
+	// ActionDeny denies the operation
+	ActionDeny = "deny"
+
+	// OpAddDevice is the operation name of add-device
+	OpAddDevice = "add-device"
+	// OpAddPath is the operation name of add-path
+	OpAddPath = "add-path"
+	// OpUpdateDevice is the operation name of update-device
+	OpUpdateDevice = "update-device"
+	// OpAddMount is the operation name of add-mount
+	OpAddMount = "add-mount"
+
+	// WildcardNumber is the major or minor number of device rules which means any number,
+	// eg: "c 136:* rwm" is requested as device c 136:-1.
+	WildcardNumber = -1
+)
+
+/* Policy file example:
+
+{
+	"defaultAction": "allow",
+	"rules": [
+		{
+			"action": "deny",
+			"operations": ["add-device"],
+			"containers": ["web-*"],
+			"devices": [{"type": "b", "major": "8", "minor": "*"}],
+			"sysfs": {"removable": "0"}
+		},
+		{
+			"action": "deny",
+			"paths": ["/etc", "/root"],
+			"mountOptions": ["rw"]
+		}
+	]
+}
+
+Rules are checked in order, the first rule matching the request decides the action.
+Criteria not specified in a rule match anything, all the specified ones must match.
+A device with wildcard number covers a range of devices, deny rules match it if they deny
+any device in the range, and allow rules match it only if they allow all devices in the range.
+*/
+
+// DeviceSelector selects devices by type and number, empty or "*" matches all.
+type DeviceSelector struct {
+	Type  string `json:"type,omitempty"`
+	Major string `json:"major,omitempty"`
+	Minor string `json:"minor,omitempty"`
+}
+
+// Rule is an allow or deny rule of policy
+type Rule struct {
+	Action       string            `json:"action"`
+	Operations   []string          `json:"operations,omitempty"`
+	Containers   []string          `json:"containers,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Devices      []DeviceSelector  `json:"devices,omitempty"`
+	Sysfs        map[string]string `json:"sysfs,omitempty"`
+	Paths        []string          `json:"paths,omitempty"`
+	MountOptions []string          `json:"mountOptions,omitempty"`
+}
+
+// Policy is the administrator policy of devices and paths
+type Policy struct {
+	DefaultAction string  `json:"defaultAction,omitempty"`
+	Rules         []*Rule `json:"rules,omitempty"`
+}
+
+// Request describes an operation to check against the policy
+type Request struct {
+	Operation    string
+	Container    string // container name
+	ContainerID  string
+	Labels       map[string]string
+	Device       *types.Device
+	Path         string // host path
+	MountOptions []string
+}
+
+// String returns the description of request for logging
+func (req *Request) String() string {
+	target := req.Path
+	if req.Device != nil {
+		target = fmt.Sprintf("%s(%s %s:%s)", req.Device.PathOnHost, req.Device.Type,
+			formatNumber(req.Device.Major), formatNumber(req.Device.Minor))
+	}
+	return fmt.Sprintf("%s %s for container %s", req.Operation, target, req.Container)
+}
+
+// Load loads the policy file, returns nil if the file does not exist.
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %v", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", path, err)
+	}
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	if p.DefaultAction != "" && p.DefaultAction != ActionAllow && p.DefaultAction != ActionDeny {
+		return fmt.Errorf("unknown default action %q", p.DefaultAction)
+	}
+	for i, r := range p.Rules {
+		if r.Action != ActionAllow && r.Action != ActionDeny {
+			return fmt.Errorf("unknown action %q of rule %d", r.Action, i)
+		}
+	}
+	return nil
+}
+
+// Check checks the request against the policy, denials are logged to syslog.
+func (p *Policy) Check(req *Request) error {
+	if p == nil {
+		return nil
+	}
+	action := p.DefaultAction
+	if action == "" {
+		action = ActionAllow
+	}
+	for _, r := range p.Rules {
+		if r.match(req) {
+			action = r.Action
+			break
+		}
+	}
+	if action == ActionDeny {
+		logrus.Errorf("Policy denied: %s", req.String())
+		return fmt.Errorf("%s is denied by policy %s", req.String(), DefaultPolicyFile)
+	}
+	return nil
+}
+
+// Check loads the default policy file and checks the request against it.
+func Check(req *Request) error {
+	p, err := Load(DefaultPolicyFile)
+	if err != nil {
+		return err
+	}
+	return p.Check(req)
+}
+
+func (r *Rule) match(req *Request) bool {
+	if len(r.Operations) > 0 && !containsString(r.Operations, req.Operation) {
+		return false
+	}
+	if len(r.Containers) > 0 && !matchContainer(r.Containers, req) {
+		return false
+	}
+	for k, v := range r.Labels {
+		if req.Labels == nil || req.Labels[k] != v {
+			return false
+		}
+	}
+	if len(r.Devices) > 0 || len(r.Sysfs) > 0 {
+		if req.Device == nil || !r.matchDevice(req.Device) {
+			return false
+		}
+	}
+	if len(r.Paths) > 0 && (req.Path == "" || !matchPath(r.Paths, req.Path)) {
+		return false
+	}
+	if len(r.MountOptions) > 0 && !matchMountOptions(r.MountOptions, req.MountOptions) {
+		return false
+	}
+	return true
+}
+
+// matchDevice matches the device by selectors and sysfs attributes of rule.
+func (r *Rule) matchDevice(device *types.Device) bool {
+	if !isWildcard(device) {
+		return (len(r.Devices) == 0 || matchDevice(r.Devices, device, false)) && matchSysfs(r.Sysfs, device)
+	}
+	if r.Action != ActionDeny {
+		// sysfs attributes can't be known for all devices in the range.
+		return len(r.Sysfs) == 0 && matchDevice(r.Devices, device, true)
+	}
+	if len(r.Devices) > 0 && !matchDevice(r.Devices, device, false) {
+		return false
+	}
+	return len(r.Sysfs) == 0 || matchSysfsRange(r, device)
+}
+
+func containsString(arr []string, s string) bool {
+	for _, a := range arr {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchContainer(patterns []string, req *Request) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, req.Container); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, req.ContainerID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isWildcard(device *types.Device) bool {
+	return device.Major == WildcardNumber || device.Minor == WildcardNumber
+}
+
+func formatNumber(number int64) string {
+	if number == WildcardNumber {
+		return "*"
+	}
+	return strconv.FormatInt(number, 10)
+}
+
+// matchNumber matches number by selector, wildcard number matches if any number matches,
+// or if all numbers match when cover is set.
+func matchNumber(selector string, number int64, cover bool) bool {
+	if selector == "" || selector == "*" {
+		return true
+	}
+	if number == WildcardNumber {
+		return !cover
+	}
+	n, err := strconv.ParseInt(selector, 10, 64)
+	return err == nil && n == number
+}
+
+func matchDevice(selectors []DeviceSelector, device *types.Device, cover bool) bool {
+	for _, s := range selectors {
+		if (s.Type == "" || s.Type == "a" || s.Type == device.Type) &&
+			matchNumber(s.Major, device.Major, cover) && matchNumber(s.Minor, device.Minor, cover) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSysfs matches the attributes under /sys/dev/<block|char>/<major>:<minor>, values can be patterns.
+func matchSysfs(attrs map[string]string, device *types.Device) bool {
+	class := "char"
+	if device.Type == "b" {
+		class = "block"
+	}
+	base := fmt.Sprintf("/sys/dev/%s/%d:%d", class, device.Major, device.Minor)
+	for attr, pattern := range attrs {
+		data, err := ioutil.ReadFile(filepath.Join(base, filepath.Clean("/"+attr)))
+		if err != nil {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern, strings.TrimSpace(string(data))); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSysfsRange matches if any device on host in range of the wildcard device is selected by the rule.
+func matchSysfsRange(r *Rule, device *types.Device) bool {
+	class := "char"
+	if device.Type == "b" {
+		class = "block"
+	}
+	entries, err := ioutil.ReadDir(filepath.Join("/sys/dev", class))
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		var major, minor int64
+		if _, err := fmt.Sscanf(entry.Name(), "%d:%d", &major, &minor); err != nil {
+			continue
+		}
+		if (device.Major != WildcardNumber && device.Major != major) ||
+			(device.Minor != WildcardNumber && device.Minor != minor) {
+			continue
+		}
+		dev := &types.Device{Type: device.Type, Major: major, Minor: minor}
+		if (len(r.Devices) == 0 || matchDevice(r.Devices, dev, false)) && matchSysfs(r.Sysfs, dev) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches path by prefixes, path should be resolved by caller,
+// the prefixes are matched both as written and resolved.
+func matchPath(prefixes []string, path string) bool {
+	path = filepath.Clean(path)
+	for _, prefix := range prefixes {
+		candidates := []string{filepath.Clean(prefix)}
+		if resolved, err := filepath.EvalSymlinks(prefix); err == nil {
+			candidates = append(candidates, resolved)
+		}
+		for _, p := range candidates {
+			if p == "/" || path == p || strings.HasPrefix(path, p+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeMountOptions adds the implied options, mounts are read-write unless ro is specified,
+// and rro is read-only too.
+func normalizeMountOptions(options []string) []string {
+	normalized := append([]string{}, options...)
+	switch {
+	case containsString(options, "rro"):
+		if !containsString(options, "ro") {
+			normalized = append(normalized, "ro")
+		}
+	case !containsString(options, "ro") && !containsString(options, "rw"):
+		normalized = append(normalized, "rw")
+	}
+	return normalized
+}
+
+func matchMountOptions(options, reqOptions []string) bool {
+	reqOptions = normalizeMountOptions(reqOptions)
+	for _, opt := range options {
+		if containsString(reqOptions, opt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: policy matching tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"isula.org/syscontainer-tools/types"
+)
+
+func TestMatchMountOptions(t *testing.T) {
+	tests := []struct {
+		options    []string
+		reqOptions []string
+		match      bool
+	}{
+		{[]string{"rw"}, []string{"rw", "rslave"}, true},
+		// mounts are read-write unless ro is specified.
+		{[]string{"rw"}, []string{"rslave"}, true},
+		{[]string{"rw"}, []string{""}, true},
+		{[]string{"rw"}, []string{"ro", "rslave"}, false},
+		{[]string{"ro"}, []string{"rslave"}, false},
+		// rro is read-only too.
+		{[]string{"ro"}, []string{"rro"}, true},
+		{[]string{"rw"}, []string{"rro"}, false},
+		{[]string{"rro"}, []string{"ro"}, false},
+		{[]string{"nosuid", "rw"}, []string{"ro", "nosuid"}, true},
+		{[]string{"shared"}, []string{"rslave"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchMountOptions(tt.options, tt.reqOptions); got != tt.match {
+			t.Errorf("matchMountOptions(%v, %v) = %v, want %v", tt.options, tt.reqOptions, got, tt.match)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		prefixes []string
+		path     string
+		match    bool
+	}{
+		{[]string{"/etc"}, "/etc", true},
+		{[]string{"/etc"}, "/etc/passwd", true},
+		{[]string{"/etc/"}, "/etc/passwd", true},
+		{[]string{"/etc"}, "/etcd", false},
+		{[]string{"/etc"}, "/var/etc", false},
+		{[]string{"/"}, "/var", true},
+		{[]string{"/root", "/etc"}, "/etc/../root/.ssh", true},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.prefixes, tt.path); got != tt.match {
+			t.Errorf("matchPath(%v, %s) = %v, want %v", tt.prefixes, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestMatchPathSymlinkPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	realDir := filepath.Join(dir, "realDir")
+	link := filepath.Join(dir, "link")
+	if err := os.Mkdir(realDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(realDir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	// the requested path is resolved by caller, the prefix written as symlink should still match.
+	if !matchPath([]string{link}, filepath.Join(realDir, "data")) {
+		t.Errorf("path under %s should match prefix %s", realDir, link)
+	}
+	if matchPath([]string{link}, filepath.Join(dir, "other")) {
+		t.Errorf("path out of %s should not match prefix %s", realDir, link)
+	}
+}
+
+func TestCheckWildcardDevice(t *testing.T) {
+	p := &Policy{
+		DefaultAction: ActionDeny,
+		Rules: []*Rule{
+			{Action: ActionDeny, Devices: []DeviceSelector{{Type: "b", Major: "8", Minor: "0"}}},
+			{Action: ActionAllow, Devices: []DeviceSelector{{Type: "b", Major: "8"}}},
+			{Action: ActionAllow, Devices: []DeviceSelector{{Type: "c", Major: "136", Minor: "1"}}},
+		},
+	}
+	tests := []struct {
+		device *types.Device
+		allow  bool
+	}{
+		{&types.Device{Type: "b", Major: 8, Minor: 1}, true},
+		{&types.Device{Type: "b", Major: 8, Minor: 0}, false},
+		// the range of rule contains the denied 8:0.
+		{&types.Device{Type: "b", Major: 8, Minor: WildcardNumber}, false},
+		{&types.Device{Type: "b", Major: WildcardNumber, Minor: WildcardNumber}, false},
+		{&types.Device{Type: "c", Major: 136, Minor: 1}, true},
+		// 136:1 is allowed, but not all devices in the range.
+		{&types.Device{Type: "c", Major: 136, Minor: WildcardNumber}, false},
+	}
+	for _, tt := range tests {
+		req := &Request{Operation: OpAddDevice, Container: "test", Device: tt.device}
+		if err := p.Check(req); (err == nil) != tt.allow {
+			t.Errorf("Check(%s) = %v, want allow %v", req.String(), err, tt.allow)
+		}
+	}
+
+	// allow rules covering the whole range allow it.
+	p.Rules = append([]*Rule{{Action: ActionAllow, Devices: []DeviceSelector{{Type: "c", Major: "136", Minor: "*"}}}}, p.Rules...)
+	req := &Request{Operation: OpAddDevice, Container: "test", Device: &types.Device{Type: "c", Major: 136, Minor: WildcardNumber}}
+	if err := p.Check(req); err != nil {
+		t.Errorf("Check(%s) = %v, want allowed", req.String(), err)
+	}
+}
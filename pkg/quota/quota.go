@@ -0,0 +1,161 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: project quota for xfs and ext4
+// Author: zhangwei
+// Create: 2018-01-18
+
+package quota
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// fsIocFsGetXattr and fsIocFsSetXattr are FS_IOC_FSGETXATTR and FS_IOC_FSSETXATTR
+	fsIocFsGetXattr = 0x801c581f
+	fsIocFsSetXattr = 0x401c5820
+	// fsXflagProjInherit is FS_XFLAG_PROJINHERIT, new files in directory inherit its project id.
+	fsXflagProjInherit = 0x200
+
+	qGetQuota = 0x800007
+	qSetQuota = 0x800008
+	prjQuota  = 2
+	// qifBLimits is QIF_BLIMITS, only the block limits are set.
+	qifBLimits = 1
+	// dqBlkSize is QIF_DQBLKSIZE, the unit of block limits.
+	dqBlkSize = 1024
+)
+
+// fsxattr is struct fsxattr of FS_IOC_FSGETXATTR
+type fsxattr struct {
+	xflags     uint32
+	extsize    uint32
+	nextents   uint32
+	projid     uint32
+	cowextsize uint32
+	pad        [8]byte
+}
+
+// dqblk is struct if_dqblk of quotactl
+type dqblk struct {
+	bHardLimit uint64
+	bSoftLimit uint64
+	curSpace   uint64
+	iHardLimit uint64
+	iSoftLimit uint64
+	curInodes  uint64
+	bTime      uint64
+	iTime      uint64
+	valid      uint32
+}
+
+func getXattr(f *os.File) (*fsxattr, error) {
+	attr := &fsxattr{}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), fsIocFsGetXattr, uintptr(unsafe.Pointer(attr))); errno != 0 {
+		return nil, errno
+	}
+	return attr, nil
+}
+
+// GetProjectID returns the project id of path
+func GetProjectID(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	attr, err := getXattr(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get project id of %s: %v", path, err)
+	}
+	return attr.projid, nil
+}
+
+func setProjectID(path string, id uint32, isDir bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	attr, err := getXattr(f)
+	if err != nil {
+		return err
+	}
+	attr.projid = id
+	if isDir {
+		if id != 0 {
+			attr.xflags |= fsXflagProjInherit
+		} else {
+			attr.xflags &^= fsXflagProjInherit
+		}
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), fsIocFsSetXattr, uintptr(unsafe.Pointer(attr))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// SetProjectID sets the project id of directory and everything in it, 0 to clear it.
+// Symlinks and special files are skipped.
+func SetProjectID(dir string, id uint32) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		if err := setProjectID(path, id, info.IsDir()); err != nil {
+			return fmt.Errorf("failed to set project id of %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+func quotactl(cmd int, device string, id uint32, dq *dqblk) error {
+	special, err := unix.BytePtrFromString(device)
+	if err != nil {
+		return err
+	}
+	qcmd := cmd<<8 | prjQuota
+	if _, _, errno := unix.Syscall6(unix.SYS_QUOTACTL, uintptr(qcmd), uintptr(unsafe.Pointer(special)),
+		uintptr(id), uintptr(unsafe.Pointer(dq)), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// SetLimit sets the space limit of project on the filesystem of device in bytes, 0 to remove the limit.
+func SetLimit(device string, id uint32, size int64) error {
+	blocks := uint64((size + dqBlkSize - 1) / dqBlkSize)
+	dq := &dqblk{
+		bHardLimit: blocks,
+		bSoftLimit: blocks,
+		valid:      qifBLimits,
+	}
+	if err := quotactl(qSetQuota, device, id, dq); err != nil {
+		return fmt.Errorf("failed to set project quota on %s, make sure it's mounted with prjquota: %v", device, err)
+	}
+	return nil
+}
+
+// GetUsage returns the space used and limit of project on the filesystem of device in bytes.
+func GetUsage(device string, id uint32) (int64, int64, error) {
+	dq := &dqblk{}
+	if err := quotactl(qGetQuota, device, id, dq); err != nil {
+		return 0, 0, err
+	}
+	return int64(dq.curSpace), int64(dq.bHardLimit * dqBlkSize), nil
+}
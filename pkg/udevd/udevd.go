@@ -15,46 +15,123 @@ package udevd
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
-	"github.com/sirupsen/logrus"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
+// usingUdevd checks whether udevd is running on host by its control socket.
+// udevd(or systemd-udevd.socket) creates the socket when it starts.
 func usingUdevd() (bool, error) {
-	return true, nil
+	fi, err := os.Stat(udevdControlSocket)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return fi.Mode()&os.ModeSocket != 0, nil
 }
 
 func reloadConfig() error {
-	_, err := exec.Command("udevadm", "control", "--reload").CombinedOutput()
-	return err
+	out, err := exec.Command("udevadm", "control", "--reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// lockFileEx opens the file and takes the exclusive flock on it in block mode.
+func lockFileEx(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	// FileLock will be released at 3 conditions:
+	//  1. process to unlock manully.
+	//  2. Close the opened fd.
+	//  3. process died without call unlock. kernel will close the file and release the lock.
+	// LOCK_EX means only one process could lock it at one time.
+	// LOCK_NB is not set, using block mode.
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
 }
 
+func formatRules(rules []*Rule) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("## This File is auto-generated by syscontainer-tools.\n")
+	buf.WriteString("## DO   NOT  EDIT   IT\n\n")
+	for _, r := range rules {
+		buf.WriteString(fmt.Sprintf("%s\n", r.ToUdevRuleString()))
+	}
+	return buf.Bytes()
+}
+
+// saveRules writes the rules to a temp file and renames it to path,
+// so that udevd and uevent watcher never see a partial written file.
 func saveRules(path string, rules []*Rule) error {
-	f, err := os.Create(path)
+	// udev rules dir may not exist on the hosts without udevd.
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// udevd only reads files with ".rules" suffix, the temp file will be ignored.
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	if err := f.Chmod(0600); err != nil {
+	if _, err := f.Write(formatRules(rules)); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
 		return err
 	}
+	if err := f.Sync(); err != nil {
+		logrus.Errorf("f.Sync err: %s", err)
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	f.Close()
+	return os.Rename(tmpPath, path)
+}
 
-	f.WriteString("## This File is auto-generated by syscontainer-tools.\n")
-	f.WriteString("## DO   NOT  EDIT   IT\n\n")
-	for _, r := range rules {
-		if _, err := f.WriteString(fmt.Sprintf("%s\n", r.ToUdevRuleString())); err != nil {
-			logrus.Errorf("f.WriteString err: %s", err)
+// updateRules saves the rules to path only if they are different from the ones on disk,
+// and removes the file if no rules left. It returns if the file is changed.
+func updateRules(path string, rules []*Rule) (bool, error) {
+	old, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	exist := err == nil
+
+	if len(rules) == 0 {
+		if !exist {
+			return false, nil
 		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return true, nil
 	}
 
-	if err := f.Sync(); err != nil {
-		logrus.Errorf("f.WriteString err: %s", err)
-		return err
+	if exist && bytes.Equal(old, formatRules(rules)) {
+		return false, nil
 	}
-	return nil
+	if err := saveRules(path, rules); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func loadRules(path string) ([]*Rule, error) {
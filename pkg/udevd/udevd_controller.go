@@ -15,17 +15,41 @@ package udevd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"syscall"
 
-	hconfig "isula.org/syscontainer-tools/config"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
+	hconfig "isula.org/syscontainer-tools/config"
 )
 
 var (
 	programe   = "/lib/udev/syscontainer-tools_wrapper"
 	lockFile   = "udevd_config_locker"
-	configPath = "/etc/udev/rules.d/99-syscontainer-tools.rules"
+	reloadLock = "udevd_reload_locker"
+	// reloadPending is created by who changed the rules and removed by who reloads udevd,
+	// so concurrent rule changes from different containers only trigger one reload.
+	reloadPending = "udevd_reload_pending"
+	// configPath is the legacy global rules file, migrated to per-container files on demand.
+	configPath         = "/etc/udev/rules.d/99-syscontainer-tools.rules"
+	configDir          = "/etc/udev/rules.d"
+	configFilePrefix   = "99-syscontainer-tools-"
+	configFileSuffix   = ".rules"
+	udevdControlSocket = "/run/udev/control"
+	// WatcherLockFile is held by the uevent watcher daemon during its whole life.
+	WatcherLockFile = filepath.Join(hconfig.IsuladToolsDir, "uevent_watcher.lock")
+	// WatcherInheritLockFlag tells the watcher daemon that the lock is taken by its starter
+	// and passed to it as fd WatcherLockFd.
+	WatcherInheritLockFlag = "inherit-lock"
+	// WatcherLockFd is the fd of the inherited lock, the first extra file of child process.
+	WatcherLockFd  = uintptr(3)
+	watcherProgram = "syscontainer-tools"
+	// udevd do not have /usr/local/bin in PATH env, hooks neither.
+	watcherDefaultPath = "/usr/local/bin/syscontainer-tools"
 )
 
 // Rule defines an udev rule which used to capture the partition udev event
@@ -38,12 +62,7 @@ type Rule struct {
 // ToUdevRuleString will format the Rule structure to udev rule
 func (r *Rule) ToUdevRuleString() string {
 	return fmt.Sprintf("KERNEL==\"%s*\",ACTION==\"add|remove\", ENV{DEVTYPE}==\"partition\", SUBSYSTEM==\"block\", RUN{program}+=\"%s $env{ACTION} %s $name %s %s\"",
-		filepath.Base(r.Name), programe, r.TrimContainerID(), r.CtrDevName, filepath.Base(r.Name))
-}
-
-// TrimContainerID will return container id for short
-func (r *Rule) TrimContainerID() string {
-	return r.Container[:8]
+		filepath.Base(r.Name), programe, r.Container, r.CtrDevName, filepath.Base(r.Name))
 }
 
 // Controller is the interface which to manage udev rules
@@ -53,88 +72,132 @@ type Controller interface {
 	LoadRules() error
 	AddRule(r *Rule)
 	RemoveRule(r *Rule)
+	Rules() []*Rule
 	ToDisk() error
+	EnsureWatcher() error
 }
 
-// NewUdevdController will return an UdevController interface
-func NewUdevdController() Controller {
+// NewUdevdController will return an UdevController interface which manages the rules of one container.
+// Rules are always stored in the udev rule config file, if udevd is not running on host,
+// the built-in uevent watcher daemon will consume them instead of udevd.
+func NewUdevdController(id string) Controller {
 	using, err := usingUdevd()
 	if err != nil {
-		return &udevdController{useUdevd: false}
+		logrus.Warnf("failed to detect udevd, use uevent watcher instead: %v", err)
+		using = false
 	}
 	return &udevdController{
 		dirty:      false,
 		useUdevd:   using,
-		configFile: configPath,
-		lockFile:   filepath.Join(hconfig.IsuladToolsDir, lockFile),
+		container:  id,
+		configFile: containerConfigFile(id),
+		lockFile:   filepath.Join(hconfig.IsuladToolsDir, fmt.Sprintf("%s_%s", lockFile, id)),
 	}
 }
 
+func containerConfigFile(id string) string {
+	return filepath.Join(configDir, configFilePrefix+id+configFileSuffix)
+}
+
 type udevdController struct {
 	useUdevd   bool
+	container  string
 	configFile string
 	lockFile   string
 	rules      []*Rule
 	dirty      bool
 	lock       *os.File
+	// legacyTaken is set if rules are moved out of the legacy global file,
+	// udevd should reload even if the rule file of container is not changed.
+	legacyTaken bool
 }
 
-// Lock uses filelock to lock the udev rule file.
+// Lock uses filelock to lock the udev rule file of the container.
 // to make sure only one process could access the resource.
 func (sc *udevdController) Lock() error {
-	if !sc.useUdevd {
-		return nil
-	}
-	f, err := os.OpenFile(sc.lockFile, os.O_RDONLY|os.O_CREATE, 0600)
+	f, err := lockFileEx(sc.lockFile)
 	if err != nil {
 		return err
 	}
-
-	// FileLock will be released at 3 conditions:
-	//  1. process to unlock manully.
-	//  2. Close the opened fd.
-	//  3. process died without call unlock. kernel will close the file and release the lock.
-	// LOCK_EX means only one process could lock it at one time.
-	// LOCK_NB is not set, using block mode.
-	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
-		f.Close()
-		return err
-	}
 	sc.lock = f
 	return nil
 }
 
 // Unlock will release the file lock
 func (sc *udevdController) Unlock() error {
-	if !sc.useUdevd || sc.lock == nil {
+	if sc.lock == nil {
 		return nil
 	}
 	defer sc.lock.Close()
 	return unix.Flock(int(sc.lock.Fd()), unix.LOCK_UN)
 }
 
-// LoadRules loads the udev rules from rule config file
+// LoadRules loads the udev rules from rule config file of the container,
+// and moves the rules of the container in legacy global rule file to it.
 func (sc *udevdController) LoadRules() error {
-	if !sc.useUdevd {
-		return nil
-	}
-
 	rules, err := loadRules(sc.configFile)
 	if err != nil {
 		return err
 	}
 	sc.rules = rules
+
+	legacy, err := sc.takeLegacyRules()
+	if err != nil {
+		return err
+	}
+	for _, r := range legacy {
+		sc.AddRule(r)
+	}
+	sc.legacyTaken = len(legacy) > 0
 	return nil
 }
 
-// AddRule will add a rule to manager in memory only
-func (sc *udevdController) AddRule(r *Rule) {
-	if !sc.useUdevd {
-		return
+// takeLegacyRules removes the rules of the container from the legacy global rule file.
+// Legacy rules are keyed by the first 8 characters of container id.
+func (sc *udevdController) takeLegacyRules() ([]*Rule, error) {
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, nil
+	}
+	f, err := lockFileEx(filepath.Join(hconfig.IsuladToolsDir, lockFile))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		unix.Flock(int(f.Fd()), unix.LOCK_UN)
+		f.Close()
+	}()
+
+	rules, err := loadRules(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var taken, left []*Rule
+	for _, r := range rules {
+		if len(r.Container) > 0 && strings.HasPrefix(sc.container, r.Container) {
+			taken = append(taken, &Rule{Name: r.Name, CtrDevName: r.CtrDevName, Container: sc.container})
+			continue
+		}
+		left = append(left, r)
+	}
+	if len(taken) == 0 {
+		return nil, nil
 	}
 
+	logrus.Infof("Migrate %d udev rules of container %s from %s", len(taken), sc.container, configPath)
+	if len(left) == 0 {
+		if err := os.Remove(configPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else if err := saveRules(configPath, left); err != nil {
+		return nil, err
+	}
+	return taken, nil
+}
+
+// AddRule will add a rule to manager in memory only
+func (sc *udevdController) AddRule(r *Rule) {
 	for _, rule := range sc.rules {
-		if r.Name == rule.Name && r.CtrDevName == rule.CtrDevName && r.TrimContainerID() == rule.TrimContainerID() {
+		if r.Name == rule.Name && r.CtrDevName == rule.CtrDevName && r.Container == rule.Container {
 			return
 		}
 	}
@@ -145,12 +208,8 @@ func (sc *udevdController) AddRule(r *Rule) {
 
 // RemoveRule will add a rule to manager in memory only
 func (sc *udevdController) RemoveRule(r *Rule) {
-	if !sc.useUdevd {
-		return
-	}
-
 	for index, rule := range sc.rules {
-		if r.Name == rule.Name && r.CtrDevName == rule.CtrDevName && r.TrimContainerID() == rule.TrimContainerID() {
+		if r.Name == rule.Name && r.CtrDevName == rule.CtrDevName && r.Container == rule.Container {
 			sc.dirty = true
 			sc.rules = append(sc.rules[:index], sc.rules[index+1:]...)
 			return
@@ -159,14 +218,163 @@ func (sc *udevdController) RemoveRule(r *Rule) {
 	return
 }
 
-// ToDisk will save the rules to udev rule config file
+// Rules returns the rules loaded in memory
+func (sc *udevdController) Rules() []*Rule {
+	return sc.rules[:]
+}
+
+// ToDisk will save the rules to udev rule config file of the container
 func (sc *udevdController) ToDisk() error {
-	if !sc.useUdevd || !sc.dirty {
+	if !sc.dirty {
+		return nil
+	}
+
+	changed, err := updateRules(sc.configFile, sc.rules)
+	if err != nil {
+		return err
+	}
+	if !changed && !sc.legacyTaken {
+		return nil
+	}
+	if sc.useUdevd {
+		return coalescedReload()
+	}
+	// watcher daemon reloads the rules for each uevent, just make sure it is running.
+	return sc.EnsureWatcher()
+}
+
+// EnsureWatcher starts the uevent watcher daemon if udevd is not running on host and the container
+// has rules, the daemon is gone after host reboots while the rules are kept.
+func (sc *udevdController) EnsureWatcher() error {
+	if sc.useUdevd || len(sc.rules) == 0 {
 		return nil
 	}
+	return startWatcher()
+}
+
+// LoadAllRules loads the rules of all containers, including the legacy ones.
+func LoadAllRules() ([]*Rule, error) {
+	files, err := filepath.Glob(filepath.Join(configDir, configFilePrefix+"*"+configFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, configPath)
+
+	var all []*Rule
+	for _, file := range files {
+		rules, err := loadRules(file)
+		if err != nil {
+			logrus.Errorf("failed to load udev rules from %s: %v", file, err)
+			continue
+		}
+		all = append(all, rules...)
+	}
+	return all, nil
+}
+
+// coalescedReload asks udevd to reload the rules.
+// If another process is reloading, wait for it, and reload again only if
+// no one has done it for us after our rule change, or its reload failed.
+func coalescedReload() error {
+	return reloadOnce(filepath.Join(hconfig.IsuladToolsDir, reloadPending),
+		filepath.Join(hconfig.IsuladToolsDir, reloadLock), reloadConfig)
+}
+
+// reloadOnce reloads if the pending marker exists. The marker is created again with the error
+// if the reload failed, so the change is still pending for the processes waiting for us.
+func reloadOnce(pending, lockPath string, reload func() error) error {
+	f, err := os.OpenFile(pending, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	lock, err := lockFileEx(lockPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		unix.Flock(int(lock.Fd()), unix.LOCK_UN)
+		lock.Close()
+	}()
+
+	last, err := ioutil.ReadFile(pending)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// reloaded by others after our change.
+			return nil
+		}
+		return err
+	}
+	if len(last) > 0 {
+		logrus.Warnf("last reload of udevd failed: %s, retry it", string(last))
+	}
+	if err := os.Remove(pending); err != nil {
+		return err
+	}
+	if err := reload(); err != nil {
+		if wErr := ioutil.WriteFile(pending, []byte(err.Error()), 0600); wErr != nil {
+			logrus.Errorf("failed to record the reload failure to %s: %v", pending, wErr)
+		}
+		return fmt.Errorf("failed to reload udevd: %v", err)
+	}
+	return nil
+}
+
+// IsWatcherRunning checks if the uevent watcher daemon is running by its file lock
+func IsWatcherRunning() (bool, error) {
+	f, err := os.OpenFile(WatcherLockFile, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if err == unix.EWOULDBLOCK {
+			return true, nil
+		}
+		return false, err
+	}
+	unix.Flock(int(f.Fd()), unix.LOCK_UN)
+	return false, nil
+}
 
-	if err := saveRules(sc.configFile, sc.rules); err != nil {
+// startWatcher starts the "syscontainer-tools watch" daemon in background if it's not running.
+// The watcher lock is taken before starting and inherited by the daemon, so concurrent callers
+// could not start more than one daemon.
+func startWatcher() error {
+	lock, err := os.OpenFile(WatcherLockFile, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	// the lock is kept by the daemon after we close our fd of it.
+	defer lock.Close()
+	if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if err == unix.EWOULDBLOCK {
+			return nil
+		}
+		return err
+	}
+
+	program, err := exec.LookPath(watcherProgram)
+	if err != nil {
+		program = watcherDefaultPath
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
 		return err
 	}
-	return reloadConfig()
+	defer devNull.Close()
+
+	cmd := exec.Command(program, "watch", "--"+WatcherInheritLockFlag)
+	cmd.Stdin = devNull
+	cmd.Stdout = devNull
+	cmd.Stderr = devNull
+	cmd.ExtraFiles = []*os.File{lock}
+	// detach from current session, the daemon should survive the caller.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start uevent watcher %s: %v", program, err)
+	}
+	logrus.Infof("udevd is not running, start uevent watcher daemon(pid: %d)", cmd.Process.Pid)
+	return cmd.Process.Release()
 }
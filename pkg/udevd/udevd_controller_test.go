@@ -0,0 +1,61 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: udev rules controller tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package udevd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "udevd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pending := filepath.Join(dir, reloadPending)
+	lockPath := filepath.Join(dir, reloadLock)
+
+	reloads := 0
+	failed := func() error {
+		reloads++
+		return errors.New("udevd is busy")
+	}
+	succeeded := func() error {
+		reloads++
+		return nil
+	}
+
+	// the failure is recorded, the change is still pending.
+	if err := reloadOnce(pending, lockPath, failed); err == nil {
+		t.Fatal("reloadOnce should return the reload error")
+	}
+	if data, err := ioutil.ReadFile(pending); err != nil || string(data) != "udevd is busy" {
+		t.Fatalf("pending marker = %q, %v, want the reload error", data, err)
+	}
+
+	// the waiters retry the failed reload.
+	if err := reloadOnce(pending, lockPath, succeeded); err != nil {
+		t.Fatal(err)
+	}
+	if reloads != 2 {
+		t.Errorf("reloads = %d, want 2", reloads)
+	}
+	if _, err := os.Stat(pending); !os.IsNotExist(err) {
+		t.Errorf("pending marker should be removed after reload, stat err: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: kernel uevent listener
+// Author: zhangwei
+// Create: 2018-01-18
+
+package udevd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// kernelUEventGroup is the netlink multicast group the kernel sends uevents to.
+	// udevd re-broadcasts processed events to group 2 with a "libudev" header, we do not care.
+	kernelUEventGroup = 1
+	uEventBufferSize  = 64 * 1024
+	uEventRcvBufSize  = 1024 * 1024
+)
+
+// UEvent is a kernel uevent received from NETLINK_KOBJECT_UEVENT socket
+type UEvent struct {
+	Action    string
+	DevPath   string
+	Subsystem string
+	DevName   string
+	DevType   string
+	Env       map[string]string
+}
+
+// String returns the short description of the uevent
+func (ev *UEvent) String() string {
+	return fmt.Sprintf("%s@%s(%s)", ev.Action, ev.DevPath, ev.DevName)
+}
+
+// ParseUEvent parses the raw netlink message sent by kernel.
+// The message looks like: "add@/devices/...\0ACTION=add\0DEVPATH=/devices/...\0SUBSYSTEM=block\0..."
+func ParseUEvent(buf []byte) (*UEvent, error) {
+	fields := bytes.Split(buf, []byte{0})
+	if len(fields) < 2 || !bytes.Contains(fields[0], []byte("@")) {
+		return nil, fmt.Errorf("invalid uevent message header: %q", fields[0])
+	}
+
+	ev := &UEvent{Env: make(map[string]string)}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(string(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		ev.Env[kv[0]] = kv[1]
+	}
+	ev.Action = ev.Env["ACTION"]
+	ev.DevPath = ev.Env["DEVPATH"]
+	ev.Subsystem = ev.Env["SUBSYSTEM"]
+	ev.DevName = ev.Env["DEVNAME"]
+	ev.DevType = ev.Env["DEVTYPE"]
+	if ev.Action == "" || ev.DevPath == "" {
+		return nil, fmt.Errorf("uevent lack of ACTION or DEVPATH: %q", fields[0])
+	}
+	return ev, nil
+}
+
+// UEventListener receives kernel uevents through netlink socket
+type UEventListener struct {
+	fd  int
+	buf []byte
+}
+
+// NewUEventListener opens a NETLINK_KOBJECT_UEVENT socket and subscribes to kernel uevents
+func NewUEventListener() (*UEventListener, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create uevent socket: %v", err)
+	}
+	// a burst of partition events may overflow the default buffer, enlarge it.
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, uEventRcvBufSize); err != nil {
+		unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, uEventRcvBufSize)
+	}
+	addr := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: kernelUEventGroup,
+		Pid:    uint32(os.Getpid()),
+	}
+	if err := unix.Bind(fd, addr); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind uevent socket: %v", err)
+	}
+	return &UEventListener{fd: fd, buf: make([]byte, uEventBufferSize)}, nil
+}
+
+// ReadEvent blocks until the next valid uevent is received
+func (l *UEventListener) ReadEvent() (*UEvent, error) {
+	for {
+		n, from, err := unix.Recvfrom(l.fd, l.buf, 0)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return nil, err
+		}
+		// only trust the messages sent by kernel.
+		if nl, ok := from.(*unix.SockaddrNetlink); !ok || nl.Pid != 0 {
+			continue
+		}
+		ev, err := ParseUEvent(l.buf[:n])
+		if err != nil {
+			continue
+		}
+		return ev, nil
+	}
+}
+
+// Close closes the netlink socket
+func (l *UEventListener) Close() error {
+	return unix.Close(l.fd)
+}
+
+// Match returns if the uevent would be captured by the udev rule,
+// it has the same semantic with the rule string generated by ToUdevRuleString.
+func (r *Rule) Match(ev *UEvent) bool {
+	if ev.Action != "add" && ev.Action != "remove" {
+		return false
+	}
+	if ev.Subsystem != "block" || ev.DevType != "partition" {
+		return false
+	}
+	return strings.HasPrefix(ev.DevName, filepath.Base(r.Name))
+}
+
+// ContainerDevName returns the device name in container for the partition of the rule,
+// eg: Name=/dev/sdc, CtrDevName=/dev/sdx, devName=sdc1 ==> /dev/sdx1
+func (r *Rule) ContainerDevName(devName string) string {
+	return r.CtrDevName + strings.Replace(devName, filepath.Base(r.Name), "", -1)
+}
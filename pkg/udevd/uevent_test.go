@@ -0,0 +1,71 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: kernel uevent tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package udevd
+
+import (
+	"strings"
+	"testing"
+)
+
+func rawUEvent(fields ...string) []byte {
+	return []byte(strings.Join(fields, "\x00"))
+}
+
+func TestParseUEvent(t *testing.T) {
+	ev, err := ParseUEvent(rawUEvent("add@/devices/virtual/block/sdc/sdc1", "ACTION=add",
+		"DEVPATH=/devices/virtual/block/sdc/sdc1", "SUBSYSTEM=block", "DEVNAME=sdc1", "DEVTYPE=partition", "SEQNUM=1024", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Action != "add" || ev.Subsystem != "block" || ev.DevName != "sdc1" || ev.DevType != "partition" {
+		t.Errorf("ParseUEvent() = %+v, unexpected fields", ev)
+	}
+	if ev.Env["SEQNUM"] != "1024" {
+		t.Errorf("ParseUEvent() env SEQNUM = %q, want 1024", ev.Env["SEQNUM"])
+	}
+
+	invalid := [][]byte{
+		// the messages re-broadcasted by udevd have no "@" in header.
+		rawUEvent("libudev", "ACTION=add", "DEVPATH=/devices/sdc"),
+		rawUEvent("add@/devices/sdc", "SUBSYSTEM=block"),
+		rawUEvent("add@/devices/sdc"),
+	}
+	for _, buf := range invalid {
+		if _, err := ParseUEvent(buf); err == nil {
+			t.Errorf("ParseUEvent(%q) should fail", buf)
+		}
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	r := &Rule{Name: "/dev/sdc", CtrDevName: "/dev/sdx", Container: "test"}
+	tests := []struct {
+		ev    *UEvent
+		match bool
+	}{
+		{&UEvent{Action: "add", Subsystem: "block", DevType: "partition", DevName: "sdc1"}, true},
+		{&UEvent{Action: "remove", Subsystem: "block", DevType: "partition", DevName: "sdc12"}, true},
+		{&UEvent{Action: "change", Subsystem: "block", DevType: "partition", DevName: "sdc1"}, false},
+		{&UEvent{Action: "add", Subsystem: "block", DevType: "disk", DevName: "sdc"}, false},
+		{&UEvent{Action: "add", Subsystem: "block", DevType: "partition", DevName: "sdd1"}, false},
+	}
+	for _, tt := range tests {
+		if got := r.Match(tt.ev); got != tt.match {
+			t.Errorf("Match(%s) = %v, want %v", tt.ev.String(), got, tt.match)
+		}
+	}
+	if name := r.ContainerDevName("sdc1"); name != "/dev/sdx1" {
+		t.Errorf("ContainerDevName(sdc1) = %s, want /dev/sdx1", name)
+	}
+}
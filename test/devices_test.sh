@@ -179,6 +179,67 @@ test_006(){
 	isula rm -f one > /dev/null
 }
 
+test_007(){
+	#test add-volume and remove-volume
+	out=`isula run --name one --hook-spec /var/lib/isulad/hooks/hookspec.json -d $UBUNTU_IMAGE bash -c "sleep 100000"`
+	container_status $out
+	if [ "${status}x" != "runningx" ]; then
+		fail $TEST_NAME "07:FAIL"
+	fi
+
+	TEST_FOLDER=$TMP/$TEST_NAME/007
+	rm -rf $TEST_FOLDER > /dev/null
+	mkdir -p $TEST_FOLDER
+
+	# the filesystem on image is mounted in container.
+	$ISULAD_TOOLS add-volume --image $TEST_FOLDER/fs.img --size 64M --fs ext4 --path /mnt/vol one > /dev/null
+	isula exec one sh -c "echo hello > /mnt/vol/b.txt" > /dev/null 2>&1
+	out=`isula exec one sh -c "cat /mnt/vol/b.txt"`
+	if [ "$out" == "hello" ]; then
+		success $TEST_NAME "07-1:PASS"
+	else
+		fail $TEST_NAME "07-1:FAIL"
+	fi
+
+	$ISULAD_TOOLS remove-volume --image $TEST_FOLDER/fs.img one > /dev/null
+	out=`isula exec one sh -c "grep ' /mnt/vol ' /proc/mounts"`
+	if [ "x$out" == "x" ] && [ -f $TEST_FOLDER/fs.img ]; then
+		success $TEST_NAME "07-2:PASS"
+	else
+		fail $TEST_NAME "07-2:FAIL"
+	fi
+
+	# the block device is exposed to container.
+	$ISULAD_TOOLS add-volume --image $TEST_FOLDER/dev.img --size 16M --device /dev/vdb one > /dev/null
+	isula exec one bash -c "dd if=/dev/vdb of=/dev/null bs=1M count=10" >&$TEST_FOLDER/ab.txt
+	out=`cat $TEST_FOLDER/ab.txt | awk -F',' 'END{print $1}'`
+	out=`echo $out | awk -F ' ' '{print $1}'`
+	if [ "$out" == "10485760" ]; then
+		success $TEST_NAME "07-3:PASS"
+	else
+		fail $TEST_NAME "07-3:FAIL"
+	fi
+
+	$ISULAD_TOOLS remove-volume --image $TEST_FOLDER/dev.img one > /dev/null
+	out=`isula exec one sh -c "ls /dev/vdb" 2>/dev/null`
+	if [ "x$out" == "x" ]; then
+		success $TEST_NAME "07-4:PASS"
+	else
+		fail $TEST_NAME "07-4:FAIL"
+	fi
+
+	# the image created is removed if failed to add it.
+	$ISULAD_TOOLS add-volume --image $TEST_FOLDER/bad.img --size 16M --fs ext4 --path /mnt/bad -o no_such_option one > /dev/null 2>&1
+	if [ $? -ne 0 ] && [ ! -f $TEST_FOLDER/bad.img ]; then
+		success $TEST_NAME "07-5:PASS"
+	else
+		fail $TEST_NAME "07-5:FAIL"
+	fi
+
+	isula rm -f one > /dev/null
+	rm -rf $TEST_FOLDER > /dev/null
+}
+
 
 main(){
 	test_001
@@ -186,6 +247,7 @@ main(){
 	test_003
 	test_004
 	test_006
+	test_007
 }
 
 main
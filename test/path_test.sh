@@ -213,6 +213,140 @@ test_008(){
 	fi
 	isula rm -f one > /dev/null
 }
+test_009(){
+	#test update-path
+	out=`isula run --name one --hook-spec /var/lib/isulad/hooks/hookspec.json -d $UBUNTU_IMAGE bash -c "sleep 100000"`
+	container_status $out
+	if [ "${status}x" != "runningx" ]; then
+		fail $TEST_NAME "09:FAIL"
+	fi
+
+	TEST_FOLDER=$TMP/$TEST_NAME/009
+	rm -rf $TEST_FOLDER > /dev/null
+	mkdir -p $TEST_FOLDER
+
+	$ISULAD_TOOLS add-path one $TEST_FOLDER:/mnt/data:ro > /dev/null
+	isula exec one sh -c "echo hello > /mnt/data/b.txt" > /dev/null 2>&1
+	if [ $? -ne 0 ]; then
+		success $TEST_NAME "09-1:PASS"
+	else
+		fail $TEST_NAME "09-1:FAIL"
+	fi
+
+	$ISULAD_TOOLS update-path one $TEST_FOLDER:/mnt/data:rw > /dev/null
+	isula exec one sh -c "echo hello > /mnt/data/b.txt" > /dev/null 2>&1
+	if [ $? -eq 0 ] && [ "`cat $TEST_FOLDER/b.txt`" == "hello" ]; then
+		success $TEST_NAME "09-2:PASS"
+	else
+		fail $TEST_NAME "09-2:FAIL"
+	fi
+
+	$ISULAD_TOOLS update-path one $TEST_FOLDER:/mnt/data:ro,nosuid > /dev/null
+	out=`$ISULAD_TOOLS list-path one | grep /mnt/data | grep ro,nosuid`
+	isula exec one sh -c "echo world > /mnt/data/b.txt" > /dev/null 2>&1
+	if [ $? -ne 0 ] && [ "x$out" != "x" ]; then
+		success $TEST_NAME "09-3:PASS"
+	else
+		fail $TEST_NAME "09-3:FAIL"
+	fi
+
+	# path not added can not be updated.
+	$ISULAD_TOOLS update-path one $TEST_FOLDER:/mnt/other:rw > /dev/null 2>&1
+	if [ $? -ne 0 ]; then
+		success $TEST_NAME "09-4:PASS"
+	else
+		fail $TEST_NAME "09-4:FAIL"
+	fi
+
+	isula rm -f one > /dev/null
+}
+
+test_010(){
+	#test add-mount and remove-mount
+	out=`isula run --name one --hook-spec /var/lib/isulad/hooks/hookspec.json -d $UBUNTU_IMAGE bash -c "sleep 100000"`
+	container_status $out
+	if [ "${status}x" != "runningx" ]; then
+		fail $TEST_NAME "10:FAIL"
+	fi
+
+	$ISULAD_TOOLS add-mount --type tmpfs --options size=16m,mode=1777 one tmpfs /mnt/cache > /dev/null
+	out=`isula exec one sh -c "grep ' /mnt/cache ' /proc/mounts | awk '{print \\$3}'"`
+	if [ "$out" == "tmpfs" ]; then
+		success $TEST_NAME "10-1:PASS"
+	else
+		fail $TEST_NAME "10-1:FAIL"
+	fi
+
+	out=`$ISULAD_TOOLS list-mount one | grep /mnt/cache`
+	if [ "x$out" != "x" ]; then
+		success $TEST_NAME "10-2:PASS"
+	else
+		fail $TEST_NAME "10-2:FAIL"
+	fi
+
+	# mounts are kept after container restarts.
+	isula restart -t 0 one > /dev/null
+	out=`isula exec one sh -c "grep ' /mnt/cache ' /proc/mounts | awk '{print \\$3}'"`
+	if [ "$out" == "tmpfs" ]; then
+		success $TEST_NAME "10-3:PASS"
+	else
+		fail $TEST_NAME "10-3:FAIL"
+	fi
+
+	$ISULAD_TOOLS remove-mount one /mnt/cache > /dev/null
+	out=`isula exec one sh -c "grep ' /mnt/cache ' /proc/mounts"`
+	if [ "x$out" == "x" ]; then
+		success $TEST_NAME "10-4:PASS"
+	else
+		fail $TEST_NAME "10-4:FAIL"
+	fi
+
+	isula rm -f one > /dev/null
+}
+
+test_011(){
+	#test gc
+	out=`isula run --name one --hook-spec /var/lib/isulad/hooks/hookspec.json -d $UBUNTU_IMAGE bash -c "sleep 100000"`
+	container_status $out
+	if [ "${status}x" != "runningx" ]; then
+		fail $TEST_NAME "11:FAIL"
+	fi
+	id=`isula inspect -f '{{.Id}}' one`
+
+	TEST_FOLDER=$TMP/$TEST_NAME/011
+	rm -rf $TEST_FOLDER > /dev/null
+	mkdir -p $TEST_FOLDER
+	echo hello > $TEST_FOLDER/b.txt
+	$ISULAD_TOOLS add-path one $TEST_FOLDER:/mnt/data:rw > /dev/null
+
+	# transfer path left by a container which no longer exists.
+	orphan=`printf '%064d' 0`
+	mkdir -p /.sharedpath/master/$orphan /.sharedpath/midpath/$orphan
+
+	out=`$ISULAD_TOOLS gc --dry-run | grep $orphan`
+	if [ "x$out" != "x" ] && [ -d /.sharedpath/master/$orphan ]; then
+		success $TEST_NAME "11-1:PASS"
+	else
+		fail $TEST_NAME "11-1:FAIL"
+	fi
+
+	$ISULAD_TOOLS gc > /dev/null
+	if [ ! -d /.sharedpath/master/$orphan ] && [ ! -d /.sharedpath/midpath/$orphan ]; then
+		success $TEST_NAME "11-2:PASS"
+	else
+		fail $TEST_NAME "11-2:FAIL"
+	fi
+
+	# resources of existing containers are never touched.
+	out=`isula exec one sh -c "cat /mnt/data/b.txt"`
+	if [ "$out" == "hello" ] && [ -d /.sharedpath/master/$id ]; then
+		success $TEST_NAME "11-3:PASS"
+	else
+		fail $TEST_NAME "11-3:FAIL"
+	fi
+
+	isula rm -f one > /dev/null
+}
 main(){
 	test_001
 	test_002
@@ -221,6 +355,9 @@ main(){
 	test_006
 	test_007
 	test_008
+	test_009
+	test_010
+	test_011
 }
 
 main
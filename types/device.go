@@ -43,6 +43,14 @@ type AddDeviceMsg struct {
 	Device *Device
 }
 
+// RemoveDeviceMsg is a parent and child message, used to transfer 'remove device' operation
+type RemoveDeviceMsg struct {
+	Device *Device
+	// MountPoints are the filesystems on the device in container, unmounted before removing the node.
+	MountPoints []string
+	Umount      string
+}
+
 // Bind is a parent and child message, used to transfer bind operation
 type Bind struct {
 	HostPath      string // Path on Host relative path, (based on entry point.)
@@ -52,6 +60,7 @@ type Bind struct {
 	MountOption   string // Bind Mount options, to dest path.
 	UID           int    // User ID
 	GID           int    // Group ID
+	UsernsPath    string // User namespace to id-map the bind, empty if container doesn't use user namespace.
 }
 
 // ToString returns the storage format string of the bind in device hook config file
@@ -72,6 +81,36 @@ type Device struct {
 	GID         uint32      // Group ID
 	Allow       bool        // Used to differ add or remove
 	Parent      string      // Parent device name(pathonhost)
+	DmUUID      string      // UUID of device-mapper device, empty for others
+	NodeAttr    *NodeAttr   // Owner and mode of node in container specified by user
+	DiskLinks   bool        // Create /dev/disk/by-* links in container or not
+	LinkPaths   []string    // Paths of /dev/disk/by-* links to create in container
+	BindNode    bool        // Bind mount the host node instead of mknod in container
+	Sharing     string      // Attachment mode: exclusive or shared, empty for default
+	CDIDevice   string      // Fully qualified name of CDI device which the node belongs to
+}
+
+// NodeAttr is the owner and mode of device node in container specified by user,
+// nil fields keep the default ones.
+type NodeAttr struct {
+	UID  *uint32 `json:"uid,omitempty"` // User ID in container
+	GID  *uint32 `json:"gid,omitempty"` // Group ID in container
+	Mode *uint32 `json:"mode,omitempty"`
+}
+
+// String returns the user input format of node attributes
+func (attr *NodeAttr) String() string {
+	var opts []string
+	if attr.UID != nil {
+		opts = append(opts, fmt.Sprintf("uid=%d", *attr.UID))
+	}
+	if attr.GID != nil {
+		opts = append(opts, fmt.Sprintf("gid=%d", *attr.GID))
+	}
+	if attr.Mode != nil {
+		opts = append(opts, fmt.Sprintf("mode=%#o", *attr.Mode))
+	}
+	return strings.Join(opts, ",")
 }
 
 // Qos is the device Qos structure
@@ -80,6 +119,9 @@ type Qos struct {
 	Minor int64  `json:"minor"`
 	Path  string `json:"path"`
 	Value string `json:"value"`
+	// Holder is the stacked device(pathonhost) which the qos is applied for,
+	// set when qos of a device-mapper device is applied to its underlying physical devices.
+	Holder string `json:"holder,omitempty"`
 }
 
 // AddDeviceOptions defines the optsions for add device operation
@@ -91,6 +133,24 @@ type AddDeviceOptions struct {
 	BlkioWeight      []*Qos
 	Force            bool
 	UpdateConfigOnly bool
+	QosOnSlaves      bool
+	ForceUnsafe      bool
+}
+
+const (
+	// UmountLazy detaches the filesystems on the device lazily
+	UmountLazy = "lazy"
+	// UmountRegular unmounts the filesystems on the device, fails if they are busy
+	UmountRegular = "regular"
+)
+
+// RemoveDeviceOptions defines the options for remove device operation
+type RemoveDeviceOptions struct {
+	FollowPartition bool
+	// Umount is the way to unmount the filesystems on the device in container, empty means refusing to remove it.
+	Umount string
+	// Force removes the device even if it's mounted in container.
+	Force bool
 }
 
 func (q Qos) String() string {
@@ -109,7 +169,12 @@ func (q Qos) GetCfqAbility() (bool, error) {
 
 // ReadCFQ read cfq value
 func (q Qos) ReadCFQ(devName string) (bool, error) {
-	path := fmt.Sprintf("/sys/block/%s/queue/scheduler", filepath.Base(devName))
+	// device name may be a symlink like /dev/mapper/vg-lv, which is not in /sys/block,
+	// the device number is always reliable.
+	path := fmt.Sprintf("/sys/dev/block/%d:%d/queue/scheduler", q.Major, q.Minor)
+	if q.Major == 0 && q.Minor == 0 {
+		path = fmt.Sprintf("/sys/block/%s/queue/scheduler", filepath.Base(devName))
+	}
 
 	cfqFile, err := os.Open(path)
 	if err != nil {
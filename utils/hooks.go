@@ -143,3 +143,13 @@ func GetUIDGid(spec *specs.Spec) (int, int) {
 	}
 	return -1, -1
 }
+
+// GetHostUIDGid translates the uid and gid in container to the ones on host
+func GetHostUIDGid(spec *specs.Spec, uid, gid uint32) (int, int) {
+	for _, namespace := range spec.Linux.Namespaces {
+		if namespace.Type == specs.UserNamespace {
+			return hostIDFromMapping(uid, spec.Linux.UIDMappings), hostIDFromMapping(gid, spec.Linux.GIDMappings)
+		}
+	}
+	return int(uid), int(gid)
+}
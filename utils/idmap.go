@@ -0,0 +1,109 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: id-mapped mount utils
+// Author: zhangwei
+// Create: 2018-01-18
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+	mymount "isula.org/syscontainer-tools/pkg/mount"
+)
+
+// the new mount api is not in vendored x/sys, the syscall numbers are the same on all architectures.
+const (
+	sysOpenTree  = 428
+	sysMoveMount = 429
+
+	openTreeClone       = 0x1
+	moveMountFEmptyPath = 0x4
+)
+
+// IDMapSupported checks if the kernel supports id-mapped mounts(linux 5.12)
+func IDMapSupported() bool {
+	return mymount.SetattrSupported()
+}
+
+// HasUserns checks if the container uses user namespace
+func HasUserns(spec *specs.Spec) bool {
+	if spec == nil || spec.Linux == nil {
+		return false
+	}
+	for _, namespace := range spec.Linux.Namespaces {
+		if namespace.Type == specs.UserNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUsernsPath returns the user namespace of container process to id-map the mounts,
+// empty if the container doesn't use user namespace.
+func GetUsernsPath(spec *specs.Spec, pid int) string {
+	if pid <= 0 || !HasUserns(spec) {
+		return ""
+	}
+	return fmt.Sprintf("/proc/%d/ns/user", pid)
+}
+
+// IDMappedMount bind mounts source to target with the id mapping of user namespace,
+// so files owned by root on host are owned by root in container, without changing their ownership.
+// With recursive, the submounts of source are bind mounted and id-mapped too.
+func IDMappedMount(source, target, usernsPath string, recursive bool) error {
+	userns, err := os.Open(usernsPath)
+	if err != nil {
+		return err
+	}
+	defer userns.Close()
+
+	src, err := unix.BytePtrFromString(source)
+	if err != nil {
+		return err
+	}
+	dst, err := unix.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	empty, err := unix.BytePtrFromString("")
+	if err != nil {
+		return err
+	}
+	fdcwd := unix.AT_FDCWD
+	treeFlags, attrFlags := openTreeClone|unix.O_CLOEXEC, unix.AT_EMPTY_PATH
+	if recursive {
+		treeFlags |= mymount.AtRecursive
+		attrFlags |= mymount.AtRecursive
+	}
+
+	fd, _, errno := unix.Syscall(sysOpenTree, uintptr(fdcwd), uintptr(unsafe.Pointer(src)), uintptr(treeFlags))
+	if errno != 0 {
+		return fmt.Errorf("open_tree %s: %v", source, errno)
+	}
+	defer unix.Close(int(fd))
+
+	attr := &mymount.Attr{
+		AttrSet:  mymount.AttrIdmap,
+		UsernsFd: uint64(userns.Fd()),
+	}
+	if err := mymount.Setattr(int(fd), "", attrFlags, attr); err != nil {
+		return fmt.Errorf("mount_setattr %s: %v", source, err)
+	}
+	if _, _, errno := unix.Syscall6(sysMoveMount, fd, uintptr(unsafe.Pointer(empty)), uintptr(fdcwd),
+		uintptr(unsafe.Pointer(dst)), moveMountFEmptyPath, 0); errno != 0 {
+		return fmt.Errorf("move_mount %s to %s: %v", source, target, errno)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: id-mapped mount utils tests
+// Author: zhangwei
+// Create: 2018-01-18
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestGetUsernsPath(t *testing.T) {
+	userns := &specs.Spec{
+		Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{{Type: specs.PIDNamespace}, {Type: specs.UserNamespace}}},
+	}
+	noUserns := &specs.Spec{
+		Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{{Type: specs.PIDNamespace}}},
+	}
+	tests := []struct {
+		spec *specs.Spec
+		pid  int
+		want string
+	}{
+		{userns, 1234, "/proc/1234/ns/user"},
+		// mounts of the container not running can't be id-mapped.
+		{userns, 0, ""},
+		{noUserns, 1234, ""},
+		{&specs.Spec{}, 1234, ""},
+		{nil, 1234, ""},
+	}
+	for _, tt := range tests {
+		if got := GetUsernsPath(tt.spec, tt.pid); got != tt.want {
+			t.Errorf("GetUsernsPath(%+v, %d) = %q, want %q", tt.spec, tt.pid, got, tt.want)
+		}
+	}
+}
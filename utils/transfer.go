@@ -16,8 +16,11 @@ package utils
 import (
 	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 
 	mymount "isula.org/syscontainer-tools/pkg/mount"
@@ -50,6 +53,9 @@ const (
       a.  (host)mount  --bind -o rw  /host1 /.sharedpath/midpath/containerid/hostpath1
       b.  (host)mount  --bind -o rw  /.sharedpath/midpath/containerid/hostpath1 /.sharedpath/master/containerid/hostpath1
       c.  (container) mount --bind -ro /.sharedpath/hostpath1 /guest1
+
+      The options of the path(eg: rbind, ro, nosuid, rslave) are applied at every step, so the submounts
+      of rbind are carried through, and the propagation of container path is chained to host path.
 */
 
 func releaseMountpoint(path string) error {
@@ -78,6 +84,21 @@ func RemoveTransferPath(id string, bind *types.Bind) error {
 	return nil
 }
 
+// RemountTransferPath changes the options of the mid path and transfer path of bind on host,
+// they are mounted with the options of bind.
+func RemountTransferPath(id string, bind *types.Bind) error {
+	midPath, tarsferPath := getTransferPath(id, bind.HostPath)
+	for _, path := range []string{midPath, tarsferPath} {
+		if m, err := mount.Mounted(path); err != nil || !m {
+			continue
+		}
+		if err := mymount.RemountBind(path, bind.MountOption); err != nil {
+			return fmt.Errorf("failed to remount %s with %s: %v", path, bind.MountOption, err)
+		}
+	}
+	return nil
+}
+
 // RemoveContainerSpecPath remove container spec
 func RemoveContainerSpecPath(id string) error {
 	if err := os.RemoveAll(GetContainerMidDir(id)); err != nil {
@@ -90,20 +111,24 @@ func RemoveContainerSpecPath(id string) error {
 	return nil
 }
 
-func parepareMountpoint(sPath, dPath, mOpt string, isDir bool) error {
+func createMountpoint(dPath string, isDir bool) error {
 	if isDir {
-		if err := os.MkdirAll(dPath, 0600); err != nil {
-			return err
-		}
-	} else {
-		if err := os.MkdirAll(filepath.Dir(dPath), 0600); err != nil {
-			return err
-		}
-		f, err := os.OpenFile(dPath, os.O_RDWR|os.O_CREATE, 0600)
-		if err != nil {
-			return fmt.Errorf("Fail to create transfer path,err: %s", err)
-		}
-		f.Close()
+		return os.MkdirAll(dPath, 0600)
+	}
+	if err := os.MkdirAll(filepath.Dir(dPath), 0600); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("Fail to create transfer path,err: %s", err)
+	}
+	f.Close()
+	return nil
+}
+
+func parepareMountpoint(sPath, dPath, mOpt string, isDir bool) error {
+	if err := createMountpoint(dPath, isDir); err != nil {
+		return err
 	}
 
 	if m, err := mount.Mounted(dPath); err != nil {
@@ -118,7 +143,9 @@ func parepareMountpoint(sPath, dPath, mOpt string, isDir bool) error {
 // To propagate mount options to container, we need two middle paths.
 func PrepareTransferPath(containerPath, id string, bind *types.Bind, doMount bool) error {
 	midpath, tarsferPath := getTransferPath(id, bind.HostPath)
-	bind.MountOption += ",bind"
+	if !mymount.IsRecursiveBind(bind.MountOption) {
+		bind.MountOption += ",bind"
+	}
 	bind.ResolvPath = filepath.Join(containerPath, getRelativePath(bind.HostPath))
 	if !doMount {
 		return nil
@@ -134,7 +161,16 @@ func PrepareTransferPath(containerPath, id string, bind *types.Bind, doMount boo
 		return err
 	}
 
-	// 3. prapare transferpath
+	// 3. prapare transferpath, id-mapped for user namespace container if supported,
+	// which keeps the ownership of host path.
+	if bind.UsernsPath != "" {
+		err := prepareIDMappedMountpoint(midpath, tarsferPath, bind)
+		if err == nil {
+			return nil
+		}
+		logrus.Warnf("Failed to id-map %s for user namespace, fall back to chown: %v", bind.HostPath, err)
+		chownFallback(bind)
+	}
 	if err := parepareMountpoint(midpath, tarsferPath, bind.MountOption, bind.IsDir); err != nil {
 		return err
 	}
@@ -142,6 +178,143 @@ func PrepareTransferPath(containerPath, id string, bind *types.Bind, doMount boo
 
 }
 
+func prepareIDMappedMountpoint(sPath, dPath string, bind *types.Bind) error {
+	if err := createMountpoint(dPath, bind.IsDir); err != nil {
+		return err
+	}
+	if m, err := mount.Mounted(dPath); err != nil {
+		return fmt.Errorf("Failed to mount path %s, err: %s", dPath, err)
+	} else if m == true {
+		return nil
+	}
+	if err := IDMappedMount(sPath, dPath, bind.UsernsPath, mymount.IsRecursiveBind(bind.MountOption)); err != nil {
+		return err
+	}
+	if err := mymount.SetMountFlags(dPath, bind.MountOption); err != nil {
+		mymount.Unmount(dPath)
+		return err
+	}
+	return nil
+}
+
+// chownFallback chowns the host path created by add-path to the root of container
+// when it could not be id-mapped, paths existed before are not changed.
+func chownFallback(bind *types.Bind) {
+	if !bind.IsDir || (bind.UID == 0 && bind.GID == 0) {
+		return
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(bind.HostPath, &st); err != nil || st.Uid != 0 || st.Gid != 0 {
+		return
+	}
+	if files, err := ioutil.ReadDir(bind.HostPath); err != nil || len(files) != 0 {
+		return
+	}
+	if err := os.Chown(bind.HostPath, bind.UID, bind.GID); err != nil {
+		logrus.Errorf("Failed to chown %s: %v", bind.HostPath, err)
+	}
+}
+
+// transferMountKey is the key of transfer path for filesystem mounted by add-mount,
+// which is distinguished from the host paths of add-path.
+func transferMountKey(destination string) string {
+	return "mount:" + destination
+}
+
+// PrepareTransferMount mounts the filesystem on the transfer path of container on host,
+// and returns the bind which mounts it to the destination in container.
+func PrepareTransferMount(containerPath, id string, m *types.Mount) (*types.Bind, error) {
+	key := transferMountKey(m.Destination)
+	_, transferPath := getTransferPath(id, key)
+	bind := &types.Bind{
+		HostPath:      m.Source,
+		ContainerPath: filepath.Join(containerPath, m.Destination),
+		ResolvPath:    filepath.Join(containerPath, getRelativePath(key)),
+		MountOption:   "bind",
+		IsDir:         true,
+		UID:           m.UID,
+		GID:           m.GID,
+	}
+
+	if err := os.MkdirAll(transferPath, 0600); err != nil {
+		return nil, err
+	}
+	if m, err := mount.Mounted(transferPath); err != nil {
+		return nil, fmt.Errorf("Failed to mount path %s, err: %s", transferPath, err)
+	} else if m == true {
+		return bind, nil
+	}
+	if err := mymount.Mount(m.Source, transferPath, m.Type, m.Options); err != nil {
+		os.Remove(transferPath)
+		return nil, fmt.Errorf("failed to mount %s on %s, err: %s", m.Source, transferPath, err)
+	}
+	return bind, nil
+}
+
+// RemoveTransferMount unmounts the filesystem mounted by PrepareTransferMount on host,
+// the mount point is kept if it fails to unmount, to protect the data on the filesystem.
+func RemoveTransferMount(id, destination string) error {
+	_, transferPath := getTransferPath(id, transferMountKey(destination))
+	if _, err := os.Stat(transferPath); os.IsNotExist(err) {
+		return nil
+	}
+	if m, err := mount.Mounted(transferPath); err != nil {
+		return err
+	} else if m {
+		if err := syscall.Unmount(transferPath, syscall.MNT_DETACH); err != nil {
+			return fmt.Errorf("failed to umount %s: %v", transferPath, err)
+		}
+	}
+	return os.Remove(transferPath)
+}
+
+// ListTransferIDs returns the ids of containers which have transfer paths on host
+func ListTransferIDs() ([]string, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, dir := range []string{masterPath, midTransferPath} {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() && !seen[f.Name()] {
+				seen[f.Name()] = true
+				ids = append(ids, f.Name())
+			}
+		}
+	}
+	return ids, nil
+}
+
+// CleanTransferPath unmounts all the transfer paths of container and removes them,
+// they are kept if any of them fails to unmount, to protect the data of host paths.
+func CleanTransferPath(id string) error {
+	mounts, err := mount.GetMounts()
+	if err != nil {
+		return err
+	}
+	var mountpoints []string
+	for _, dir := range []string{GetContainerSpecDir(id), GetContainerMidDir(id)} {
+		for _, m := range mounts {
+			if strings.HasPrefix(m.Mountpoint, dir+"/") {
+				mountpoints = append(mountpoints, m.Mountpoint)
+			}
+		}
+	}
+	// unmount the nested ones first.
+	sort.Sort(sort.Reverse(sort.StringSlice(mountpoints)))
+	for _, mp := range mountpoints {
+		if err := syscall.Unmount(mp, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL {
+			return fmt.Errorf("failed to umount %s: %v", mp, err)
+		}
+	}
+	return RemoveContainerSpecPath(id)
+}
+
 func getRelativePath(hostpath string) string {
 	return filepath.Join(slavePath, getTransferBase(hostpath))
 }
@@ -154,6 +327,12 @@ func getTransferBase(path string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(path)))
 }
 
+// GetTransferPath returns the transfer path of host path on host
+func GetTransferPath(id, hostpath string) string {
+	_, transfer := getTransferPath(id, hostpath)
+	return transfer
+}
+
 // GetContainerSpecDir get container spec dir
 func GetContainerSpecDir(id string) string {
 	return filepath.Join(masterPath, id)
@@ -19,21 +19,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"isula.org/syscontainer-tools/container"
 	"isula.org/syscontainer-tools/libdevice"
 	"isula.org/syscontainer-tools/types"
 
+	"github.com/docker/go-units"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
 var addPathCommand = cli.Command{
-	Name:        "add-path",
-	Usage:       "add one or more host paths to container",
-	ArgsUsage:   `<container_id> hostpath:containerpath:permission [hostpath:containerpath:permission ...]`,
-	Description: `You can add multiple host paths to container.`,
-	Flags:       []cli.Flag{},
+	Name:      "add-path",
+	Usage:     "add one or more host paths to container",
+	ArgsUsage: `<container_id> hostpath:containerpath:permission [hostpath:containerpath:permission ...]`,
+	Description: `You can add multiple host paths to container. With --quota, the host directories are assigned
+a project id and limited by project quota, the filesystem should be xfs or ext4 mounted with prjquota.
+
+The permission is a comma separated list of mount options, "rw,rslave" by default:
+	ro, rw, rro          read-only, read-write, or read-only including submounts(linux 5.12)
+	rbind                bind the submounts of host path too
+	private, rprivate, slave, rslave, shared, rshared
+	                     propagation of the path in container, slave and shared ones receive mounts from host,
+	                     shared ones require host path on a shared mount, mounts in container don't propagate to host
+	nosuid, suid, nodev, dev, noexec, exec
+	atime, noatime, relatime, strictatime, diratime, nodiratime`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "quota",
+			Usage: "Limit the space of host directories by project quota, eg: 20G",
+		},
+	},
 	Action: func(context *cli.Context) {
 		if context.NArg() < 2 {
 			fatalf("%s: %q requires a minimum of 2 args", os.Args[0], context.Command.Name)
@@ -50,7 +68,7 @@ var addPathCommand = cli.Command{
 			fatal(err)
 		}
 
-		if err := libdevice.AddPath(c, binds); err != nil {
+		if err := libdevice.AddPath(c, binds, context.String("quota")); err != nil {
 			fatalf("Failed to add path: %v", err)
 		}
 		logrus.Infof("add path to container %q successfully", name)
@@ -86,11 +104,57 @@ var rmPathCommand = cli.Command{
 	},
 }
 
+var updatePathCommand = cli.Command{
+	Name:      "update-path",
+	Usage:     "change mount options of one or more paths added to container",
+	ArgsUsage: `<container_id> hostpath:containerpath:permission [hostpath:containerpath:permission ...]`,
+	Description: `You can change the mount options of paths added by add-path, the binds in running container
+are remounted with the new options, without removing them. rbind and rro could not be changed by remount,
+nosuid, nodev, noexec and atime flags of the mount are kept unless suid, dev, exec or another atime option
+is specified, clearing the ones locked in user namespace fails. eg: switch a path from rw to ro:
+	syscontainer-tools update-path <container_id> /host/share:/share:ro,rslave`,
+	Flags: []cli.Flag{},
+	Action: func(context *cli.Context) {
+		if context.NArg() < 2 {
+			fatalf("%s: %q requires a minimum of 2 args", os.Args[0], context.Command.Name)
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		for _, v := range context.Args()[1:] {
+			if strings.Count(v, ":") != 2 {
+				fatalf("Failed to parse bind: %s, new permission should be specified", v)
+			}
+		}
+		binds, err := getBinds(context, c, false)
+		if err != nil {
+			fatal(err)
+		}
+
+		if err := libdevice.UpdatePath(c, binds); err != nil {
+			fatalf("Failed to update path: %v", err)
+		}
+		logrus.Infof("update path of container %q successfully", name)
+	},
+}
+
 var listPathCommand = cli.Command{
 	Name:      "list-path",
 	Usage:     "list all paths mounted to container",
 	ArgsUsage: `<container_id>`,
+	Description: `This command lists the paths added by syscontainer-tools, along with the live mount status:
+whether host path exists, whether it's mounted on the transfer path on host and in container,
+and the device and filesystem which host path is on.`,
 	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "json",
+			Usage: "Output format: table or json",
+		},
 		cli.BoolFlag{
 			Name:  "pretty, p",
 			Usage: "If this flag is set, list pathes in pretty json form",
@@ -103,6 +167,10 @@ var listPathCommand = cli.Command{
 		if context.NArg() > 1 {
 			fatalf("Don't put container-id in the middle of options")
 		}
+		format := context.String("format")
+		if format != "table" && format != "json" {
+			fatalf("unknown format %q, table or json is supported", format)
+		}
 
 		name := context.Args()[0]
 		c, err := container.New(name)
@@ -110,38 +178,229 @@ var listPathCommand = cli.Command{
 			fatal(err)
 		}
 
-		binds, err := libdevice.ListPath(c)
+		paths, err := libdevice.ListPath(c)
 		if err != nil {
 			fatalf("Failed to list path in container: %v", err)
 		}
-		if binds == nil || len(binds) == 0 {
+		if format == "table" {
+			printPathTable(paths)
+			logrus.Infof("list path in container %q successfully", name)
+			return
+		}
+		if len(paths) == 0 {
 			logrus.Infof("list path in container %q successfully", name)
 			return
 		}
 
-		bindsData, err := json.Marshal(binds)
+		pathsData, err := json.Marshal(paths)
 		if err != nil {
 			fatalf("failed to Marshal path config: %v", err)
 		}
-		bindsBuffer := new(bytes.Buffer)
-		if _, err = bindsBuffer.Write(bindsData); err != nil {
-			fatalf("Buffer Write error %v", err)
-		}
-
-		if context.Bool("pretty") {
-			bindsBuffer.Truncate(0)
-			if json.Indent(bindsBuffer, bindsData, "", "\t") != nil {
+		// the buffer must not share memory with the data, it's overwritten by indent.
+		pathsBuffer := new(bytes.Buffer)
+		if !context.Bool("pretty") {
+			pathsBuffer.Write(pathsData)
+		} else {
+			if err := json.Indent(pathsBuffer, pathsData, "", "\t"); err != nil {
 				fatalf("failed to Indent path data: %v", err)
 			}
 		}
+		pathsBuffer.WriteString("\n")
+		if _, err := os.Stdout.Write(pathsBuffer.Bytes()); err != nil {
+			logrus.Errorf("Write pathsBuffer error %v", err)
+		}
+		logrus.Infof("list path in container %q successfully", name)
+	},
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
 
-		if _, err = bindsBuffer.WriteString("\n"); err != nil {
-			fatalf("Buffer WriteString error %v", err)
+func printPathTable(paths []*libdevice.PathStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST-PATH\tCONTAINER-PATH\tOPTIONS\tUID:GID\tHOST-EXISTS\tTRANSFER-MOUNTED\tCONTAINER-MOUNTED\tDEVICE\tFSTYPE\tQUOTA")
+	for _, p := range paths {
+		device := p.Device
+		if device == "" {
+			device = "-"
+		} else if p.DeviceNumber != "" {
+			device = fmt.Sprintf("%s(%s)", p.Device, p.DeviceNumber)
 		}
-		if _, err := os.Stdout.Write(bindsBuffer.Bytes()); err != nil {
-			logrus.Errorf("Write bindsBuffer error %v", err)
+		fsType := p.FsType
+		if fsType == "" {
+			fsType = "-"
 		}
-		logrus.Infof("list path in container %q successfully", name)
+		quota := "-"
+		if p.Quota > 0 {
+			quota = fmt.Sprintf("%s/%s", units.BytesSize(float64(p.QuotaUsed)), units.BytesSize(float64(p.Quota)))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d:%d\t%s\t%s\t%s\t%s\t%s\t%s\n", p.HostPath, p.ContainerPath, p.Options, p.UID, p.GID,
+			yesNo(p.HostExists), yesNo(p.TransferMounted), yesNo(p.ContainerMounted), device, fsType, quota)
+	}
+	w.Flush()
+}
+
+var addVolumeCommand = cli.Command{
+	Name:      "add-volume",
+	Usage:     "attach an image file to container as volume by loop device",
+	ArgsUsage: `<container_id>`,
+	Description: `You can attach an image file to container by loop device, the image is created as a sparse file
+of --size and formatted as --fs if it doesn't exist. The filesystem is mounted at --path in container,
+or the block device is exposed as --device. The loop device is released when container stops, and
+attached again when it starts, example:
+	syscontainer-tools add-volume --image /path/vol.img --size 10G --fs ext4 --path /data <container_id>`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "image",
+			Usage: "Path of the image file on host",
+		},
+		cli.StringFlag{
+			Name:  "size",
+			Usage: "Size of the image to create if it doesn't exist, eg: 10G",
+		},
+		cli.StringFlag{
+			Name:  "fs",
+			Usage: "Filesystem type to format the new image and mount it",
+		},
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "Mount the filesystem at the path in container",
+		},
+		cli.StringFlag{
+			Name:  "device",
+			Usage: "Expose the block device as the path in container instead of mounting it",
+		},
+		cli.StringFlag{
+			Name:  "options, o",
+			Usage: "Comma separated mount options, eg: ro,noatime",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() != 1 {
+			fatalf("%s: %q must accept a container-id", os.Args[0], context.Command.Name)
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		v, err := libdevice.ParseVolume(context.String("image"), context.String("fs"),
+			context.String("path"), context.String("device"), context.String("options"))
+		if err != nil {
+			fatal(err)
+		}
+		if err := libdevice.AddVolume(c, v, context.String("size")); err != nil {
+			fatalf("Failed to add volume: %v", err)
+		}
+		logrus.Infof("add volume to container %q successfully", name)
+	},
+}
+
+var rmVolumeCommand = cli.Command{
+	Name:      "remove-volume",
+	Usage:     "remove the volume added by add-volume from container",
+	ArgsUsage: `<container_id>`,
+	Description: `You can remove the volume from container, the filesystem is unmounted or the block device
+is removed from container, and the loop device is detached. The image file is kept.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "image",
+			Usage: "Path of the image file on host",
+		},
+		cli.StringFlag{
+			Name:  "umount",
+			Usage: "Unmount the filesystems on the exposed device in container before removing it, 'lazy' or 'regular'",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Remove the exposed device even if it's mounted in container",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() != 1 {
+			fatalf("%s: %q must accept a container-id", os.Args[0], context.Command.Name)
+		}
+		if context.String("image") == "" {
+			fatalf("--image should be specified")
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		opts := &types.RemoveDeviceOptions{
+			Umount: context.String("umount"),
+			Force:  context.Bool("force"),
+		}
+		if opts.Umount != "" && opts.Umount != types.UmountLazy && opts.Umount != types.UmountRegular {
+			fatalf("invalid umount mode: %s, 'lazy' or 'regular' is supported", opts.Umount)
+		}
+		if err := libdevice.RemoveVolume(c, context.String("image"), opts); err != nil {
+			fatalf("Failed to remove volume: %v", err)
+		}
+		logrus.Infof("remove volume from container %q successfully", name)
+	},
+}
+
+var listVolumeCommand = cli.Command{
+	Name:      "list-volume",
+	Usage:     "list all volumes added to container by add-volume",
+	ArgsUsage: `<container_id>`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "pretty, p",
+			Usage: "If this flag is set, list volumes in pretty json form",
+		},
+	},
+	Action: func(context *cli.Context) {
+		if context.NArg() < 1 {
+			fatalf("%s: %q must accept a container-id", os.Args[0], context.Command.Name)
+		}
+		if context.NArg() > 1 {
+			fatalf("Don't put container-id in the middle of options")
+		}
+
+		name := context.Args()[0]
+		c, err := container.New(name)
+		if err != nil {
+			fatal(err)
+		}
+
+		volumes, err := libdevice.ListVolume(c)
+		if err != nil {
+			fatalf("Failed to list volume in container: %v", err)
+		}
+		if len(volumes) == 0 {
+			logrus.Infof("list volume in container %q successfully", name)
+			return
+		}
+
+		volumesData, err := json.Marshal(volumes)
+		if err != nil {
+			fatalf("failed to Marshal volume config: %v", err)
+		}
+		// the buffer must not share memory with the data, it's overwritten by indent.
+		volumesBuffer := new(bytes.Buffer)
+		if !context.Bool("pretty") {
+			volumesBuffer.Write(volumesData)
+		} else {
+			if err := json.Indent(volumesBuffer, volumesData, "", "\t"); err != nil {
+				fatalf("failed to Indent volume data: %v", err)
+			}
+		}
+		volumesBuffer.WriteString("\n")
+		if _, err := os.Stdout.Write(volumesBuffer.Bytes()); err != nil {
+			logrus.Errorf("Write volumesBuffer error %v", err)
+		}
+		logrus.Infof("list volume in container %q successfully", name)
 	},
 }
 
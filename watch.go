@@ -0,0 +1,151 @@
+// Copyright (c) Huawei Technologies Co., Ltd. 2018-2019. All rights reserved.
+// syscontainer-tools is licensed under the Mulan PSL v2.
+// You can use this software according to the terms and conditions of the Mulan PSL v2.
+// You may obtain a copy of Mulan PSL v2 at:
+//    http://license.coscl.org.cn/MulanPSL2
+// THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND, EITHER EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT, MERCHANTABILITY OR FIT FOR A PARTICULAR
+// PURPOSE.
+// See the Mulan PSL v2 for more details.
+// Description: uevent watcher daemon command
+// Author: zhangwei
+// Create: 2018-01-18
+
+// go base main package
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"isula.org/syscontainer-tools/container"
+	"isula.org/syscontainer-tools/libdevice"
+	"isula.org/syscontainer-tools/pkg/udevd"
+	"isula.org/syscontainer-tools/types"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// devtmpfs creates the node before kernel sends the uevent,
+	// but wait a while in case of /dev is not a devtmpfs.
+	waitDevNodeTimeout = 3 * time.Second
+)
+
+var watchCommand = cli.Command{
+	Name:  "watch",
+	Usage: "watch kernel uevents and propagate partitions to containers on hosts without udevd",
+	Description: `This command runs as a daemon, it subscribes to kernel uevents and
+performs the same add/remove device actions as the udev rules added by syscontainer-tools.
+It is started automatically when udevd is not running on host.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:   udevd.WatcherInheritLockFlag,
+			Usage:  "the watcher lock is taken by the starter and inherited",
+			Hidden: true,
+		},
+	},
+	Action: func(context *cli.Context) {
+		var lock *os.File
+		if context.Bool(udevd.WatcherInheritLockFlag) {
+			lock = os.NewFile(udevd.WatcherLockFd, udevd.WatcherLockFile)
+		} else {
+			var err error
+			if lock, err = os.OpenFile(udevd.WatcherLockFile, os.O_RDONLY|os.O_CREATE, 0600); err != nil {
+				fatal(err)
+			}
+		}
+		defer lock.Close()
+		// only one watcher is allowed on host, the lock is held until the daemon exits.
+		if err := unix.Flock(int(lock.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+			fatalf("uevent watcher is already running: %v", err)
+		}
+
+		listener, err := udevd.NewUEventListener()
+		if err != nil {
+			fatal(err)
+		}
+		defer listener.Close()
+
+		logrus.Infof("uevent watcher(pid: %d) started", os.Getpid())
+		for {
+			ev, err := listener.ReadEvent()
+			if err == unix.ENOBUFS {
+				// kernel drops the uevents overflowing the socket buffer, keep handling the later ones.
+				logrus.Warnf("uevent socket buffer overflowed, some uevents are lost")
+				continue
+			}
+			if err != nil {
+				fatalf("failed to read uevent: %v", err)
+			}
+			handleUEvent(ev)
+		}
+	},
+}
+
+func handleUEvent(ev *udevd.UEvent) {
+	if ev.Subsystem != "block" || ev.DevType != "partition" || ev.DevName == "" {
+		return
+	}
+
+	// rule files are replaced atomically, no need to lock them for reading.
+	rules, err := udevd.LoadAllRules()
+	if err != nil {
+		logrus.Errorf("failed to load udev rules: %v", err)
+		return
+	}
+
+	for _, r := range rules {
+		if !r.Match(ev) {
+			continue
+		}
+		logrus.Infof("uevent %s matched rule of container %s", ev.String(), r.Container)
+		if err := applyUEventRule(ev, r); err != nil {
+			logrus.Errorf("failed to %s device %s for container %s: %v", ev.Action, ev.DevName, r.Container, err)
+		}
+	}
+}
+
+func applyUEventRule(ev *udevd.UEvent, r *udevd.Rule) error {
+	mapping := fmt.Sprintf("%s:%s", filepath.Join("/dev", ev.DevName), r.ContainerDevName(ev.DevName))
+
+	c, err := container.New(r.Container)
+	if err != nil {
+		return err
+	}
+
+	switch ev.Action {
+	case "add":
+		if err := libdevice.WaitDevice(filepath.Join("/dev", ev.DevName), waitDevNodeTimeout); err != nil {
+			return err
+		}
+		device, err := libdevice.ParseDevice(mapping)
+		if err != nil {
+			return err
+		}
+		if basedev, err := types.GetBaseDevName(device.PathOnHost); err == nil {
+			device.Parent = basedev
+		}
+		devices := []*types.Device{device}
+		if err := setDevicesPath(c, devices); err != nil {
+			return err
+		}
+		return libdevice.AddDevice(c, devices, &types.AddDeviceOptions{})
+	case "remove":
+		device, err := libdevice.ParseMapping(mapping)
+		if err != nil {
+			return err
+		}
+		devices := []*types.Device{device}
+		if err := setDevicesPath(c, devices); err != nil {
+			return err
+		}
+		// the partition has gone from host, filesystems on it are not usable anymore.
+		return libdevice.RemoveDevice(c, devices, &types.RemoveDeviceOptions{Force: true})
+	}
+	return nil
+}